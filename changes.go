@@ -0,0 +1,180 @@
+// Copyright © 2024 Bruce Smith <bruceesmith@gmail.com>
+// Use of this source code is governed by the MIT
+// License that can be found in the LICENSE file.
+
+package echidna
+
+import (
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+
+	kmaps "github.com/knadh/koanf/maps"
+)
+
+const (
+	// reloadTag is the struct tag which marks a field as one which
+	// cannot change while the program is running
+	reloadTag = "reload"
+)
+
+// Change is the difference in the value of a configuration key made by
+// reloading the configuration. The values of secrets are redacted
+type Change struct {
+	Key    string
+	Old    any  // The previous value, nil if the key was not set
+	New    any  // The new value, nil if the key is no longer set
+	Static bool // The key is, or is within, a field tagged reload:"static"
+}
+
+// staticField is a field tagged reload:"static"
+type staticField struct {
+	key   string
+	index []int
+}
+
+var (
+	// staticWarnOnly is set by WarnOnStaticChanges
+	staticWarnOnly bool
+)
+
+// WarnOnStaticChanges is an Option which allows a reload of the configuration
+// to proceed when it changes a field tagged reload:"static". Such a field keeps
+// its previous value until the program is restarted, and a warning naming the
+// field is logged. Without this Option, the reload is rejected
+func WarnOnStaticChanges() Option {
+	return func() error {
+		staticWarnOnly = true
+		return nil
+	}
+}
+
+// Changed reports whether a reload changed the value of a key, or of any
+// key within it. For example, Changed("database") is true if database.host
+// changed
+func (e ReloadEvent) Changed(key string) bool {
+	key = strings.ToLower(key)
+	return slices.ContainsFunc(e.Changes, func(c Change) bool { return within(strings.ToLower(c.Key), key) })
+}
+
+// String describes a change, such as "server.port: 80 -> 8080"
+func (c Change) String() string {
+	return fmt.Sprintf("%s: %v -> %v", c.Key, c.Old, c.New)
+}
+
+// diffConfigs returns the changes between two configurations, in key order
+func diffConfigs(old, updated Configurator) []Change {
+	oldRaw, oldShown := flatConfig(old)
+	newRaw, newShown := flatConfig(updated)
+	keys := slices.Collect(maps.Keys(oldRaw))
+	for k := range newRaw {
+		if _, ok := oldRaw[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys)
+	static := staticFields(reflect.TypeOf(updated), "", nil)
+	var changes []Change
+	for _, k := range keys {
+		if reflect.DeepEqual(oldRaw[k], newRaw[k]) {
+			continue
+		}
+		changes = append(changes, Change{
+			Key:    k,
+			Old:    oldShown[k],
+			New:    newShown[k],
+			Static: slices.ContainsFunc(static, func(f staticField) bool { return within(k, f.key) }),
+		})
+	}
+	return changes
+}
+
+// flatConfig returns the leaf values of a configuration, as they are
+// and with secrets redacted
+func flatConfig(cfg Configurator) (raw, shown map[string]any) {
+	if cfg == nil {
+		return map[string]any{}, map[string]any{}
+	}
+	v := reflect.ValueOf(cfg)
+	rm, _ := plainValue(v, "", false, false).(map[string]any)
+	sm, _ := plainValue(v, "", false, true).(map[string]any)
+	raw, _ = kmaps.Flatten(rm, nil, ".")
+	shown, _ = kmaps.Flatten(sm, nil, ".")
+	return raw, shown
+}
+
+// within reports whether key is the same as, or is within, another key
+func within(key, outer string) bool {
+	return key == outer || strings.HasPrefix(key, outer+".") || strings.HasPrefix(key, outer+"[")
+}
+
+// staticFields is a recursive function which returns the fields of a
+// struct type, and of the structs nested within it, which are tagged
+// reload:"static". A field within a slice or map is covered only by
+// a tag on the slice or map field itself
+func staticFields(t reflect.Type, prefix string, index []int) []staticField {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if !isNested(t) {
+		return nil
+	}
+	var result []staticField
+	for i := range t.NumField() {
+		field := t.Field(i)
+		name := keyName(field)
+		if name == "" {
+			continue
+		}
+		key := joinKey(prefix, name)
+		fieldIndex := append(slices.Clone(index), i)
+		if field.Tag.Get(reloadTag) == "static" {
+			result = append(result, staticField{key: key, index: fieldIndex})
+			continue
+		}
+		result = append(result, staticFields(field.Type, key, fieldIndex)...)
+	}
+	return result
+}
+
+// keepStatic copies the values of the static fields changed by a reload
+// from the old configuration to the new one
+func keepStatic(old, updated Configurator, changes []Change) {
+	ov, nv := reflect.ValueOf(old).Elem(), reflect.ValueOf(updated).Elem()
+	for _, f := range staticFields(nv.Type(), "", nil) {
+		if !slices.ContainsFunc(changes, func(c Change) bool { return c.Static && within(c.Key, f.key) }) {
+			continue
+		}
+		from, err := ov.FieldByIndexErr(f.index)
+		if err != nil {
+			continue
+		}
+		to, err := nv.FieldByIndexErr(f.index)
+		if err != nil {
+			continue
+		}
+		to.Set(from)
+	}
+}
+
+// staticKeys returns the keys of the static fields changed by a reload
+func staticKeys(changes []Change) []string {
+	var keys []string
+	for _, c := range changes {
+		if c.Static {
+			keys = append(keys, c.Key)
+		}
+	}
+	return keys
+}
+
+// changedKeys returns the keys changed by a reload
+func changedKeys(changes []Change) []string {
+	keys := make([]string, len(changes))
+	for i, c := range changes {
+		keys[i] = c.Key
+	}
+	return keys
+}
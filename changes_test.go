@@ -0,0 +1,144 @@
+// Copyright © 2024 Bruce Smith <bruceesmith@gmail.com>
+// Use of this source code is governed by the MIT
+// License that can be found in the LICENSE file.
+
+package echidna
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type changesDatabase struct {
+	Driver   string `koanf:"driver" reload:"static"`
+	Password string `koanf:"password" secret:"true"`
+	Pool     int    `koanf:"pool"`
+}
+
+type changesConfig struct {
+	Listen   string            `koanf:"listen" reload:"static"`
+	Level    string            `koanf:"level"`
+	Database changesDatabase   `koanf:"database"`
+	Labels   map[string]string `koanf:"labels"`
+}
+
+func (c *changesConfig) Validate() error { return nil }
+
+func Test_diffConfigs(t *testing.T) {
+	old := &changesConfig{
+		Listen:   ":80",
+		Level:    "info",
+		Database: changesDatabase{Driver: "pg", Password: "old-secret", Pool: 5},
+		Labels:   map[string]string{"a": "1"},
+	}
+	updated := &changesConfig{
+		Listen:   ":80",
+		Level:    "debug",
+		Database: changesDatabase{Driver: "mysql", Password: "new-secret", Pool: 5},
+		Labels:   map[string]string{"b": "2"},
+	}
+	want := []Change{
+		{Key: "database.driver", Old: "pg", New: "mysql", Static: true},
+		{Key: "database.password", Old: redactedValue, New: redactedValue},
+		{Key: "labels.a", Old: "1", New: nil},
+		{Key: "labels.b", Old: nil, New: "2"},
+		{Key: "level", Old: "info", New: "debug"},
+	}
+	got := diffConfigs(old, updated)
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("diffConfigs() =\n%v\nwant\n%v", got, want)
+	}
+	event := ReloadEvent{Changes: got}
+	for key, want := range map[string]bool{"database": true, "Database.Pool": false, "labels": true, "listen": false, "level": true} {
+		if event.Changed(key) != want {
+			t.Errorf("ReloadEvent.Changed(%s) = %v, want %v", key, !want, want)
+		}
+	}
+	if diffConfigs(old, old) != nil {
+		t.Errorf("diffConfigs() of a configuration with itself found changes")
+	}
+
+	keepStatic(old, updated, got)
+	if updated.Database.Driver != "pg" || updated.Level != "debug" {
+		t.Errorf("keepStatic() = %+v", updated)
+	}
+}
+
+func Test_reload_static(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.yml")
+	write := func(content string) {
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("listen: \":80\"\nlevel: info\n")
+	var cfg changesConfig
+	cmd := reloadCommand(t, &cfg)
+	var events []ReloadEvent
+	defer func() {
+		configuration = nil
+		pristine = nil
+		configloaders = nil
+		reloadListeners = nil
+		reloadState = nil
+		staticWarnOnly = false
+		configRules = nil
+		runArgs = nil
+		publish(nil)
+		resetOrigins()
+	}()
+	if err := OnReload(func(e ReloadEvent) { events = append(events, e) })(); err != nil {
+		t.Fatal(err)
+	}
+	runArgs = []string{"test", "--config", path}
+	if err := cmd.Run(context.Background(), runArgs); err != nil {
+		t.Fatalf("before() error = %v", err)
+	}
+
+	// Without changes, nothing is reported
+	if changes, err := reload("test"); err != nil || changes != nil || len(events) != 0 {
+		t.Errorf("reload() without changes = %v, %v, and %d events", changes, err, len(events))
+	}
+
+	// A change to a static field is rejected
+	write("listen: \":81\"\nlevel: debug\n")
+	if _, err := reload("test"); err == nil {
+		t.Errorf("reload() accepted a change to a static field")
+	}
+	if Current().(*changesConfig).Level != "info" {
+		t.Errorf("Current() changed after a rejected reload")
+	}
+
+	// Unless only warnings were requested, in which case the static field keeps its value
+	staticWarnOnly = true
+	changes, err := reload("test")
+	if err != nil {
+		t.Fatalf("reload() error = %v", err)
+	}
+	want := []Change{{Key: "level", Old: "info", New: "debug"}}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("reload() changes = %v, want %v", changes, want)
+	}
+	if current := Current().(*changesConfig); current.Listen != ":80" || current.Level != "debug" {
+		t.Errorf("Current() = %+v", current)
+	}
+	if len(events) != 1 || !reflect.DeepEqual(events[0].Changes, want) {
+		t.Errorf("reload listener events = %+v", events)
+	}
+
+	// The static field keeping its value must not break a rule
+	if err = ConfigRule(`level != "trace" || listen != ":80"`, "tracing needs another listener")(); err != nil {
+		t.Fatal(err)
+	}
+	write("listen: \":81\"\nlevel: trace\n")
+	if _, err = reload("test"); err == nil || !strings.Contains(err.Error(), "tracing needs another listener") {
+		t.Errorf("reload() error = %v, want the rule to fail", err)
+	}
+	if current := Current().(*changesConfig); current.Level != "debug" {
+		t.Errorf("Current() = %+v after an invalid reload", current)
+	}
+}
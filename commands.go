@@ -0,0 +1,56 @@
+// Copyright © 2024 Bruce Smith <bruceesmith@gmail.com>
+// Use of this source code is governed by the MIT
+// License that can be found in the LICENSE file.
+
+package echidna
+
+import (
+	set "github.com/deckarep/golang-set/v2"
+	"github.com/urfave/cli/v3"
+)
+
+var (
+	// configCommands are the subcommands of the "config" command, which
+	// are added by Options
+	configCommands []*cli.Command
+
+	// standaloneCommands are the subcommands which do not need the
+	// configuration to be loaded before they run
+	standaloneCommands = set.NewSet[*cli.Command]()
+)
+
+// addConfigCommand adds a subcommand to the "config" command. A standalone
+// subcommand runs without the configuration first being loaded and validated
+func addConfigCommand(command *cli.Command, isStandalone bool) {
+	configCommands = append(configCommands, command)
+	if isStandalone {
+		standaloneCommands.Add(command)
+	}
+}
+
+// configCommand returns the "config" command, which groups the
+// subcommands that operate upon the configuration
+func configCommand() *cli.Command {
+	return &cli.Command{
+		Name:     "config",
+		Usage:    "manage the configuration",
+		Commands: configCommands,
+	}
+}
+
+// standalone reports whether the subcommand about to be run is one
+// which has no need of the configuration, such as help or version
+func standalone(cmd *cli.Command) bool {
+	current := cmd
+	for _, arg := range cmd.Args().Slice() {
+		sub := current.Command(arg)
+		if sub == nil {
+			return false
+		}
+		if sub == version || sub.Name == "help" || standaloneCommands.Contains(sub) {
+			return true
+		}
+		current = sub
+	}
+	return false
+}
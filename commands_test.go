@@ -0,0 +1,79 @@
+// Copyright © 2024 Bruce Smith <bruceesmith@gmail.com>
+// Use of this source code is governed by the MIT
+// License that can be found in the LICENSE file.
+
+package echidna
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/urfave/cli/v3"
+)
+
+func Test_standalone(t *testing.T) {
+	action := func(context.Context, *cli.Command) error { return nil }
+	addConfigCommand(&cli.Command{Name: "alone", Action: action}, true)
+	addConfigCommand(&cli.Command{Name: "show", Action: action}, false)
+	defer func() {
+		configCommands = nil
+		standaloneCommands.Clear()
+	}()
+	tests := []struct {
+		name string
+		args []string
+		want bool
+	}{
+		{
+			name: "none",
+			args: []string{"test"},
+			want: false,
+		},
+		{
+			name: "version",
+			args: []string{"test", "version"},
+			want: true,
+		},
+		{
+			name: "help",
+			args: []string{"test", "help"},
+			want: true,
+		},
+		{
+			name: "config-standalone",
+			args: []string{"test", "config", "alone", "x"},
+			want: true,
+		},
+		{
+			name: "config-other",
+			args: []string{"test", "config", "show"},
+			want: false,
+		},
+		{
+			name: "positional",
+			args: []string{"test", "version2"},
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got bool
+			cmd := &cli.Command{
+				Name: "test",
+				Before: func(ctx context.Context, cmd *cli.Command) (context.Context, error) {
+					got = standalone(cmd)
+					return ctx, nil
+				},
+				Action:    action,
+				Commands:  []*cli.Command{version, configCommand()},
+				Writer:    io.Discard,
+				ErrWriter: io.Discard,
+			}
+			_ = cmd.Run(context.Background(), tt.args)
+			if got != tt.want {
+				t.Errorf("standalone() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
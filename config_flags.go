@@ -33,8 +33,9 @@ import (
 //   - as a result, values for struct-bound fields are set in this order
 //     1. default value in the configuration struct
 //     2. value set in one of the configuration sources loaded by [knadh/koanf]
-//     3. environment variable configured by [bruceesmith/sflags]
-//     4. flag value from the command line
+//     3. environment variable read by [ConfigEnv]
+//     4. environment variable configured by [bruceesmith/sflags]
+//     5. flag value from the command line
 type binder struct {
 	clone        Configurator
 	configFields map[string]reflect.Value
@@ -140,6 +141,12 @@ func ConfigFlags(configs []Configurator, command *cli.Command, ops ...FlagOption
 		}
 		flags := make([]cli.Flag, 0)
 		for i, cfg := range configs {
+			// Apply any default tags first, so that the defaults appear in help
+			if t := reflect.TypeOf(cfg); t != nil && t.Kind() == reflect.Pointer && t.Elem().Kind() == reflect.Struct {
+				if err := applyDefaults(cfg); err != nil {
+					return fmt.Errorf("ConfigFlags() failed to apply defaults for configuration %d: [%w]", i, err)
+				}
+			}
 			flgs := make([]cli.Flag, 0)
 			err := gcli.ParseToV3(
 				cfg,
@@ -185,10 +192,11 @@ func applyFlagOverrides(names []string, b binder) {
 
 }
 
-// clone safely creates an exact copy of a configuration struct
+// clone safely creates an exact copy of a configuration struct. The copy is
+// deep, so that maps and slices are not shared with the original
 func clone(in Configurator) Configurator {
 	out := reflect.New(reflect.ValueOf(in).Elem().Type()).Interface().(Configurator)
-	err := copier.Copy(out, in)
+	err := copier.CopyWithOption(out, in, copier.Option{DeepCopy: true})
 	if err != nil {
 		logger.Warn("failed to clone Configurator", "error", err)
 	}
@@ -229,6 +237,17 @@ func mapFields(v reflect.Value, prefix string, result *map[string]reflect.Value)
 	}
 }
 
+// rebind returns a binder which applies the same flag values as b
+// to the fields of another instance of the configuration struct
+func (b binder) rebind(cfg Configurator) (binder, error) {
+	fields, err := fieldMap(cfg)
+	if err != nil {
+		return b, fmt.Errorf("cannot build a field map for the configuration: [%w]", err)
+	}
+	b.configFields = fields
+	return b, nil
+}
+
 // newFlagBinder creates a binder, the basis for associating and setting
 // configuration struct fields from command line flags
 func newFlagBinder(cfg Configurator) (b binder, err error) {
@@ -0,0 +1,51 @@
+// Copyright © 2024 Bruce Smith <bruceesmith@gmail.com>
+// Use of this source code is governed by the MIT
+// License that can be found in the LICENSE file.
+
+package echidna
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/knadh/koanf/providers/confmap"
+	"github.com/knadh/koanf/v2"
+)
+
+const (
+	// defaultTag is the struct tag holding the default value of a configuration field
+	defaultTag = "default"
+)
+
+// applyDefaults sets every zero-valued field of a configuration struct that
+// has a default tag to the value of that tag. The tag value is decoded exactly
+// as a value read from a configuration source would be, so durations, byte
+// sizes ("10MB"), slices ("a,b,c"), maps ("k1=v1,k2=v2") and types implementing
+// encoding.TextUnmarshaler are all supported. Fields already holding a value are left untouched
+func applyDefaults(cfg any) error {
+	v := reflect.ValueOf(cfg)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("defaults can only be applied to a pointer to a struct")
+	}
+	values := make(map[string]any)
+	for _, f := range configFields(v) {
+		def, ok := f.Field.Tag.Lookup(defaultTag)
+		if !ok || !f.Value.IsZero() {
+			continue
+		}
+		values[f.Key] = def
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	k := koanf.New(".")
+	err := k.Load(confmap.Provider(values, "."), nil)
+	if err != nil {
+		return fmt.Errorf("failed to load default values: [%w]", err)
+	}
+	err = unmarshal(k, cfg)
+	if err != nil {
+		return fmt.Errorf("invalid default value: [%w]", err)
+	}
+	return nil
+}
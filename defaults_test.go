@@ -0,0 +1,123 @@
+// Copyright © 2024 Bruce Smith <bruceesmith@gmail.com>
+// Use of this source code is governed by the MIT
+// License that can be found in the LICENSE file.
+
+package echidna
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+type defaultsServer struct {
+	Host    string        `default:"localhost"`
+	Port    int           `default:"8080"`
+	Timeout time.Duration `default:"30s"`
+}
+
+type defaultsConfig struct {
+	Server  defaultsServer
+	Tags    []string          `default:"a,b"`
+	Limits  map[string]int    `default:"cpu=2,mem=512"`
+	Labels  map[string]string `koanf:"labels"`
+	Debug   bool              `default:"true"`
+	Preset  string            `default:"tag"`
+	NoValue string
+}
+
+type defaultsSizes struct {
+	MaxBody  int64         `default:"10MB"`
+	Buffer   uint32        `default:"64KiB"`
+	Cache    int           `default:"1.5 GB"`
+	Count    int           `default:"12"`
+	Interval time.Duration `default:"1m"`
+}
+
+type badDefault struct {
+	Port int `default:"eighty"`
+}
+
+func Test_applyDefaults(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     any
+		want    any
+		wantErr bool
+	}{
+		{
+			name: "all",
+			cfg:  &defaultsConfig{Preset: "literal"},
+			want: &defaultsConfig{
+				Server: defaultsServer{
+					Host:    "localhost",
+					Port:    8080,
+					Timeout: 30 * time.Second,
+				},
+				Tags:   []string{"a", "b"},
+				Limits: map[string]int{"cpu": 2, "mem": 512},
+				Debug:  true,
+				Preset: "literal",
+			},
+		},
+		{
+			name: "nested-literal-kept",
+			cfg:  &defaultsConfig{Server: defaultsServer{Port: 9090}},
+			want: &defaultsConfig{
+				Server: defaultsServer{
+					Host:    "localhost",
+					Port:    9090,
+					Timeout: 30 * time.Second,
+				},
+				Tags:   []string{"a", "b"},
+				Limits: map[string]int{"cpu": 2, "mem": 512},
+				Debug:  true,
+				Preset: "tag",
+			},
+		},
+		{
+			name: "sizes",
+			cfg:  &defaultsSizes{},
+			want: &defaultsSizes{
+				MaxBody:  10_000_000,
+				Buffer:   65536,
+				Cache:    1_500_000_000,
+				Count:    12,
+				Interval: time.Minute,
+			},
+		},
+		{
+			name: "bad-size",
+			cfg: &struct {
+				Buffer uint8 `default:"1KB"`
+			}{},
+			wantErr: true,
+		},
+		{
+			name: "no-defaults",
+			cfg:  &config{I: 1},
+			want: &config{I: 1},
+		},
+		{
+			name:    "bad-default",
+			cfg:     &badDefault{},
+			wantErr: true,
+		},
+		{
+			name:    "not-a-pointer",
+			cfg:     defaultsConfig{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := applyDefaults(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("applyDefaults() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(tt.cfg, tt.want) {
+				t.Errorf("applyDefaults() = %+v, want %+v", tt.cfg, tt.want)
+			}
+		})
+	}
+}
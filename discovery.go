@@ -0,0 +1,152 @@
+// Copyright © 2024 Bruce Smith <bruceesmith@gmail.com>
+// Use of this source code is governed by the MIT
+// License that can be found in the LICENSE file.
+
+package echidna
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/bruceesmith/logger"
+)
+
+var (
+	// discoveryName is the basename of configuration files that are searched
+	// for when --config is not provided. Discovery is disabled if it is empty
+	discoveryName string
+
+	// hostname returns the name of this host, used to find per-host overlay files
+	hostname = os.Hostname
+
+	// ignoredSuffixes are the endings of files left behind by editors and
+	// package managers, which are never loaded by discovery
+	ignoredSuffixes = []string{"~", ".bak", ".dpkg-dist", ".dpkg-old", ".orig", ".rpmnew", ".rpmsave", ".swp", ".tmp"}
+
+	// systemConfigDir is the root of the system-wide configuration directories
+	systemConfigDir = "/etc"
+)
+
+// DiscoverConfig is an Option which causes configuration files to be
+// searched for whenever the --config flag is not provided. The argument
+// is the basename of the application's configuration files, and the
+// following locations are searched in order:
+//
+//  1. /etc/<name>/<name>.*
+//  2. $XDG_CONFIG_HOME/<name>/<name>.* (or ~/.config/<name>/<name>.*)
+//  3. ~/.<name>.*
+//  4. <name>.* in the working directory
+//
+// Every file found, and for which a [Loader] exists, is loaded, with files
+// later in the order overriding those earlier. Each file may be accompanied
+// by a per-host overlay named <name>.<host>.<ext> (where host is the short
+// host name) that is loaded immediately after it
+func DiscoverConfig(name string) Option {
+	return func() error {
+		if name == "" || strings.ContainsAny(name, `/\`) {
+			return fmt.Errorf("DiscoverConfig requires a simple file basename, not %q", name)
+		}
+		discoveryName = name
+		return nil
+	}
+}
+
+// discover returns the configuration files that exist in the standard
+// locations, in the order in which they should be loaded
+func discover(name string) []string {
+	var host string
+	if h, err := hostname(); err == nil {
+		host, _, _ = strings.Cut(h, ".")
+	}
+	home, _ := os.UserHomeDir()
+	xdg := os.Getenv("XDG_CONFIG_HOME")
+	if xdg == "" && home != "" {
+		xdg = filepath.Join(home, ".config")
+	}
+
+	prefixes := []string{filepath.Join(systemConfigDir, name, name)}
+	if xdg != "" {
+		prefixes = append(prefixes, filepath.Join(xdg, name, name))
+	}
+	if home != "" {
+		prefixes = append(prefixes, filepath.Join(home, "."+name))
+	}
+	prefixes = append(prefixes, name)
+
+	var (
+		found []string
+		seen  = make(map[string]bool)
+	)
+	for _, prefix := range prefixes {
+		for _, path := range discoverAt(prefix, host) {
+			abs, err := filepath.Abs(path)
+			if err != nil {
+				abs = path
+			}
+			if seen[abs] {
+				continue
+			}
+			seen[abs] = true
+			logger.Debug("discovered configuration file", "path", path)
+			found = append(found, path)
+		}
+	}
+	return found
+}
+
+// discoverAt returns the configuration files named <prefix>.<ext>, each
+// followed by its per-host overlay <prefix>.<host>.<ext> if there is one
+func discoverAt(prefix, host string) []string {
+	matches, err := filepath.Glob(prefix + ".*")
+	if err != nil {
+		return nil
+	}
+	slices.Sort(matches)
+	var (
+		bases    []string
+		overlays = make(map[string]string)
+	)
+	for _, path := range matches {
+		if !loadable(path) {
+			continue
+		}
+		rest := strings.TrimPrefix(path, prefix+".")
+		if h, ext, found := strings.Cut(rest, "."); found {
+			if host != "" && h == host && !strings.Contains(ext, ".") {
+				overlays[ext] = path
+			}
+			continue
+		}
+		bases = append(bases, path)
+	}
+	var result []string
+	for _, base := range bases {
+		result = append(result, base)
+		if overlay, ok := overlays[strings.TrimPrefix(base, prefix+".")]; ok {
+			result = append(result, overlay)
+		}
+	}
+	return result
+}
+
+// loadable reports whether a discovered path is a regular file that one
+// of the configured Loaders recognises. A SniffLoader accepts any file,
+// so it is not consulted, lest stray files such as <name>.log be loaded
+func loadable(path string) bool {
+	for _, suffix := range ignoredSuffixes {
+		if strings.HasSuffix(path, suffix) {
+			return false
+		}
+	}
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return false
+	}
+	return slices.ContainsFunc(configloaders, func(l Loader) bool {
+		_, sniffs := l.Parser.(sniffer)
+		return !sniffs && l.Match(path)
+	})
+}
@@ -0,0 +1,193 @@
+// Copyright © 2024 Bruce Smith <bruceesmith@gmail.com>
+// Use of this source code is governed by the MIT
+// License that can be found in the LICENSE file.
+
+package echidna
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/urfave/cli/v3"
+)
+
+func TestDiscoverConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		arg     string
+		wantErr bool
+	}{
+		{
+			name: "ok",
+			arg:  "app",
+		},
+		{
+			name:    "empty",
+			arg:     "",
+			wantErr: true,
+		},
+		{
+			name:    "path",
+			arg:     "etc/app",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := DiscoverConfig(tt.arg)()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DiscoverConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && discoveryName != tt.arg {
+				t.Errorf("DiscoverConfig() discoveryName = %v, want %v", discoveryName, tt.arg)
+			}
+			discoveryName = ""
+		})
+	}
+}
+
+// discoveryTree creates a set of files beneath root and points the
+// discovery locations at them
+func discoveryTree(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(root, "work"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	systemConfigDir = filepath.Join(root, "etc")
+	t.Setenv("HOME", filepath.Join(root, "home"))
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(root, "xdg"))
+	t.Chdir(filepath.Join(root, "work"))
+	hostname = func() (string, error) { return "myhost.example.com", nil }
+	t.Cleanup(func() {
+		systemConfigDir = "/etc"
+		hostname = os.Hostname
+	})
+	return root
+}
+
+func Test_discover(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  []string
+	}{
+		{
+			name: "all-locations",
+			files: map[string]string{
+				"etc/app/app.yml":    "i: 1",
+				"xdg/app/app.json":   `{"i": 2}`,
+				"home/.app.toml":     "i = 3",
+				"work/app.yaml":      "i: 4",
+				"work/unrelated.yml": "i: 5",
+			},
+			want: []string{
+				"etc/app/app.yml",
+				"xdg/app/app.json",
+				"home/.app.toml",
+				"app.yaml",
+			},
+		},
+		{
+			name: "host-overlays",
+			files: map[string]string{
+				"etc/app/app.yml":             "i: 1",
+				"etc/app/app.myhost.yml":      "i: 2",
+				"etc/app/app.otherhost.yml":   "i: 3",
+				"work/app.json":               `{"i": 4}`,
+				"work/app.myhost.json":        `{"i": 5}`,
+				"work/app.myhost.example.yml": "i: 6",
+			},
+			want: []string{
+				"etc/app/app.yml",
+				"etc/app/app.myhost.yml",
+				"app.json",
+				"app.myhost.json",
+			},
+		},
+		{
+			name: "ignored",
+			files: map[string]string{
+				"work/app.yml~":    "i: 1",
+				"work/app.yml.bak": "i: 2",
+				"work/app.ini":     "i=3",
+				"work/app.go":      "package main",
+				"work/app.log":     "started",
+				"work/app.d/x":     "",
+			},
+			want: nil,
+		},
+		{
+			name:  "nothing",
+			files: map[string]string{},
+			want:  nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := discoveryTree(t, tt.files)
+			configloaders = DefaultLoaders()
+			got := discover("app")
+			var want []string
+			for _, w := range tt.want {
+				if filepath.Dir(w) == "." {
+					want = append(want, w)
+				} else {
+					want = append(want, filepath.Join(root, w))
+				}
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("discover() = %v, want %v", got, want)
+			}
+			configloaders = nil
+		})
+	}
+}
+
+func Test_before_discovery(t *testing.T) {
+	discoveryTree(t, map[string]string{
+		"etc/app/app.yml": "i: 1",
+		"work/app.yml":    "i: 33",
+	})
+	var cfg config
+	configuration = &cfg
+	configloaders = DefaultLoaders()
+	discoveryName = "app"
+	cmd := &cli.Command{
+		Name:   "test",
+		Before: before,
+		Action: func(context.Context, *cli.Command) error {
+			return nil
+		},
+		Flags: []cli.Flag{
+			&cli.StringSliceFlag{
+				Name: "config",
+			},
+		},
+	}
+	buf := &bytes.Buffer{}
+	cmd.Writer = buf
+	cmd.ErrWriter = buf
+	if err := cmd.Run(context.Background(), []string{"test"}); err != nil {
+		t.Errorf("before() with discovery error = %v", err)
+	}
+	if cfg.I != 33 {
+		t.Errorf("before() with discovery I = %v, want 33", cfg.I)
+	}
+	configuration = nil
+	configloaders = nil
+	discoveryName = ""
+}
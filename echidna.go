@@ -10,7 +10,15 @@ Every program using echidna will expose a standard set of command-line flags (--
 addition to the standard flags provided by urfave/cli/v3 (--help and --version).
 
 If a configuration struct is provided to [Run] function by [Configuration], then a further command-line flag (--config) is added to
-provide the source(s) of values for fields in the struct.
+provide the source(s) of values for fields in the struct. Each source is read by the first [Loader] which matches
+it; [DefaultLoaders] provides Loaders for the common configuration file formats, an [HTTPLoader] can be
+added for sources named by an http:// or https:// URL, and [KVLoader] reads from a key-value store such as etcd. When --config is not given,
+[DiscoverConfig] can be used to search the standard locations for configuration files. A configuration file can
+itself name further files to be read with its top-level "extends" and "include" keys, and values of the form
+secret://<provider>/<reference> are resolved by the [SecretProvider] registered under that name.
+[ConfigCommand] adds a "config" command whose subcommands display and check the configuration.
+With [WatchConfig] or [ReloadOnSignal], the configuration is reloaded when its files change or on SIGHUP,
+and [Current] returns the latest.
 
 Command-line flags bound to fields in the configuration are created by providing [ConfigFlags] to [Run]. These flags can be
 bound either to the root command or to one or more child commands.
@@ -27,6 +35,7 @@ package echidna
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
@@ -49,6 +58,7 @@ type Configurator interface {
 
 // configLoader is a parameter to koanf.Load()
 type configLoader struct {
+	Path     string // The source named by --config or an include, if any
 	Provider koanf.Provider
 	Parser   koanf.Parser
 	Options  []koanf.Option
@@ -56,11 +66,23 @@ type configLoader struct {
 
 // Loader is a parameter to [Configuration] which determines
 // how configuration sources are loaded into the confguration
-// struct
+// struct.
+//
+// Format optionally names the configuration format handled by the
+// Loader (e.g. "yaml"). A source given as format:path, for example
+// yaml:/dev/fd/3, is loaded by the Loader with that Format regardless
+// of its Match function.
+//
+// Options are passed to koanf.Load() for every source read by the Loader.
+// They can include koanf.WithMergeFunc() to control how the source is
+// merged with those loaded before it, overriding any merge tags on the
+// fields of the configuration struct
 type Loader struct {
+	Format   string
 	Provider func(string) koanf.Provider
 	Parser   koanf.Parser
 	Match    func(string) bool
+	Options  []koanf.Option
 }
 
 // Option is a functional parameter for Run()
@@ -179,49 +201,76 @@ func before(ctx context.Context, cmd *cli.Command) (cctx context.Context, err er
 	if err = logging(cmd); err != nil {
 		return ctx, fmt.Errorf("command initialisation failed: [%w]", err)
 	}
-	// Read, parse, validate and store the configuration
-	if configuration != nil {
+	// Keep secret configuration values out of the logs
+	redactLogs()
+	// Read, parse, validate and store the configuration. This happens even if no
+	// configuration sources were named, so that flag values are applied and the
+	// result is always validated
+	if configuration != nil && !standalone(cmd) {
 		configs := cmd.StringSlice("config")
-		if len(configs) == 0 {
-			return ctx, nil
-		} else {
-			// The command line has been parsed and values set for any provided flags. If
-			// any of the flags were generated from the configuration struct by the [bruceesmith/sflags] package,
-			// and any of these mapped flags were provided on the command line, then the associated
-			// fields in the configuration struct have been updated from the relevant command line flag(s).
-			//
-			// The configuration is about to be updated by reading from any configuration sources provided
-			// by the flag --config. This would override the flag values that have just been saved. So the
-			// configuration is copied at this point. Later, these flag values will be applied again
-			// (because flags override values loaded from the configuration sources). Whew ....
-			binds, err := newFlagBinder(configuration)
-			if err != nil {
-				return ctx, fmt.Errorf("configuration handling failed: [%w]", err)
-			}
+		if len(configs) == 0 && discoveryName != "" {
+			configs = discover(discoveryName)
+		}
+		// The command line has been parsed and values set for any provided flags. If
+		// any of the flags were generated from the configuration struct by the [bruceesmith/sflags] package,
+		// and any of these mapped flags were provided on the command line, then the associated
+		// fields in the configuration struct have been updated from the relevant command line flag(s).
+		//
+		// The configuration is about to be updated by reading from any configuration sources provided
+		// by the flag --config. This would override the flag values that have just been saved. So the
+		// configuration is copied at this point. Later, these flag values will be applied again
+		// (because flags override values loaded from the configuration sources). Whew ....
+		binds, err := newFlagBinder(configuration)
+		if err != nil {
+			return ctx, fmt.Errorf("configuration handling failed: [%w]", err)
+		}
 
-			// Build a list of configuration source providers
-			var theLoaders []configLoader
-			theLoaders, err = loaders(configs)
-			if err != nil {
-				return ctx, fmt.Errorf("config load error: [%w]", err)
-			}
+		// Build a list of configuration source providers
+		var theLoaders []configLoader
+		theLoaders, err = loaders(configs)
+		if err != nil {
+			return ctx, fmt.Errorf("config load error: [%w]", err)
+		}
+		if envConfig != nil {
+			theLoaders = append(theLoaders, envConfig.envLoader())
+		}
+		if encryption != nil {
+			encryption.flagFile = cmd.String("config-key-file")
+		}
 
-			// Read, parse, store the configuration
-			err = configure(configuration, theLoaders)
-			if err != nil {
-				return ctx, fmt.Errorf("configuration loading failed: [%w]", err)
-			}
+		// Read, parse, store the configuration
+		err = configure(configuration, theLoaders)
+		if err != nil {
+			return ctx, fmt.Errorf("configuration loading failed: [%w]", err)
+		}
 
-			// Update the configuration that has just been loaded with any values that were provided
-			// on the command line
-			applyFlagOverrides(cmd.FlagNames(), binds)
+		// Update the configuration that has just been loaded with any values that were provided
+		// on the command line
+		applyFlagOverrides(cmd.FlagNames(), binds)
+		recordFlagOrigins(cmd, configuration, cmd.FlagNames(), binds)
 
-			// Finally, validate the resulting configuration
-			err = configuration.Validate()
-			if err != nil {
-				return ctx, fmt.Errorf("configuration validation failed: [%w]", err)
-			}
+		// Finally, validate the resulting configuration
+		err = validateConfig(configuration)
+		if err != nil {
+			return ctx, fmt.Errorf("configuration validation failed: [%w]", redactError(err))
+		}
 
+		// Keep what is needed to load the configuration again, and watch
+		// for changes to its files if asked to
+		publish(configuration)
+		reloadState = &reloader{
+			cmd:       cmd,
+			sources:   configs,
+			binds:     binds,
+			flagNames: cmd.FlagNames(),
+		}
+		if watchFiles {
+			if err = startWatching(theLoaders); err != nil {
+				return ctx, fmt.Errorf("configuration watch failed: [%w]", err)
+			}
+		}
+		if reloadOnSignal {
+			startSignals(cmd)
 		}
 	}
 	return ctx, err
@@ -230,13 +279,41 @@ func before(ctx context.Context, cmd *cli.Command) (cctx context.Context, err er
 // configure reads the configuration from the nominated sources, unmarshals it into
 // the provided struct
 func configure(config Configurator, configLoaders []configLoader) (err error) {
+	resetOrigins()
+	sourceFiles = nil
 	konfigurator := koanf.New(".")
 	err = readConfig(konfigurator, configLoaders...)
 	if err != nil {
 		return fmt.Errorf("failed to load configuration: [%w]", err)
 	}
 
-	err = konfigurator.Unmarshal("", config)
+	if encryption != nil {
+		konfigurator, err = decryptValues(konfigurator)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt configuration: [%w]", err)
+		}
+	}
+
+	if interpolation {
+		konfigurator, err = interpolate(konfigurator)
+		if err != nil {
+			return fmt.Errorf("failed to interpolate configuration: [%w]", err)
+		}
+	}
+
+	konfigurator, err = resolveSecrets(konfigurator)
+	if err != nil {
+		return fmt.Errorf("failed to resolve configuration secrets: [%w]", err)
+	}
+
+	if strict != strictOff {
+		err = checkUnknownKeys(konfigurator, config)
+		if err != nil {
+			return fmt.Errorf("configuration has unknown keys: [%w]", err)
+		}
+	}
+
+	err = unmarshal(konfigurator, config)
 	if err != nil {
 		return fmt.Errorf("failed to unmarshal configuration: [%w]", err)
 	}
@@ -245,7 +322,25 @@ func configure(config Configurator, configLoaders []configLoader) (err error) {
 }
 
 // Configuration is an Option helper to define a configuration structure
-// that will be populated from the sources given on a --config command-line flag
+// that will be populated from the sources given on a --config command-line flag.
+//
+// Any field of the structure that has a `default:"..."` tag, and which does not
+// already hold a value, is set from that tag before any source is loaded
+//
+// A field may have a `validate:"..."` tag holding comma-separated rules which its
+// value must satisfy, for example `validate:"required,min=1,max=65535"`. The rules are
+// required, min=N and max=N (the value of a number or duration, otherwise a length),
+// oneof=a b c, hostname, url, uri, email, ip, ipv4, ipv6, file_exists and dir_exists.
+// Apart from required, min and max, the rules pass an empty value and apply to each
+// element of a slice. The rules are checked once the configuration has been loaded,
+// before Validate is called; every failure is reported, as a [ValidationErrors] whose
+// entries are identified by their key path such as server.tls.cert_file. Rules which
+// relate one field to another are given by [ConfigRule]. Validate is only called when
+// all of the rules are satisfied
+//
+// A field tagged `secret:"true"` holds sensitive data. Wherever echidna displays the
+// configuration, logs it or reports an error from Validate, the values of such fields
+// (within nested structs, slices and maps alike) are replaced by [REDACTED]
 func Configuration(config Configurator, loaders []Loader) Option {
 	return func() error {
 		if reflect.TypeOf(config).Kind() != reflect.Pointer {
@@ -257,8 +352,18 @@ func Configuration(config Configurator, loaders []Loader) Option {
 		if len(loaders) == 0 {
 			return fmt.Errorf("at least one configuration Loader is required")
 		}
+		if err := applyDefaults(config); err != nil {
+			return fmt.Errorf("configuration defaults could not be applied: [%w]", err)
+		}
+		if _, err := mergeStrategies(config); err != nil {
+			return fmt.Errorf("configuration merge tags are invalid: [%w]", err)
+		}
+		if err := checkRuleTags(config); err != nil {
+			return fmt.Errorf("configuration validate tags are invalid: [%w]", err)
+		}
 		configuration = config
 		configloaders = loaders
+		pristine = clone(config)
 		return nil
 	}
 }
@@ -302,30 +407,55 @@ func flag(cmd *cli.Command, name string) (value any, found bool) {
 	return value, false
 }
 
-// loaders constructs a configuration loader for each nominated source
+// loaders constructs a configuration loader for each nominated source.
+//
+// A source of "-" is read from standard input, and a source of the form
+// format:path is parsed as the named format. Otherwise the first Loader
+// whose Match function accepts the source is used
 func loaders(paths []string) ([]configLoader, error) {
 	loaders := make([]configLoader, len(paths))
+	stdins := 0
 	for i, path := range paths {
 		var (
 			found  bool
 			loader configLoader
 		)
-	loop:
-		for _, cl := range configloaders {
-			if cl.Match(path) {
-				loader = configLoader{
-					Provider: cl.Provider(path),
-					Parser:   cl.Parser,
-					Options:  []koanf.Option{},
+		format, source := splitFormat(path)
+		if source == "-" {
+			stdins++
+			if stdins > 1 {
+				return nil, fmt.Errorf("standard input can only be used once as a configuration source")
+			}
+		}
+		switch {
+		case format != "":
+			loader, found = formatLoader(format, source)
+		case source == "-":
+			loader = configLoader{
+				Provider: stdinProvider{r: stdin},
+				Parser:   sniffer{},
+				Options:  slices.Concat([]koanf.Option{}, mergeOptions()),
+			}
+			found = true
+		default:
+		loop:
+			for _, cl := range configloaders {
+				if cl.Match(path) {
+					loader = configLoader{
+						Provider: cl.Provider(path),
+						Parser:   cl.Parser,
+						Options:  slices.Concat([]koanf.Option{}, mergeOptions(), cl.Options),
+					}
+					found = true
+					break loop
 				}
-				found = true
-				break loop
 			}
 		}
 		if !found {
 			err := fmt.Errorf("no configuration loader defined for %s", path)
 			return nil, err
 		}
+		loader.Path = source
 		loaders[i] = loader
 	}
 	return loaders, nil
@@ -444,11 +574,12 @@ func printVersion(cmd *cli.Command) {
 
 }
 
-// readConfig reads the configuration from the nominated sources
+// readConfig reads the configuration from the nominated sources, together
+// with any files that they include or extend
 func readConfig(k *koanf.Koanf, sources ...configLoader) error {
 	var err, result error
 	for _, source := range sources {
-		err = k.Load(source.Provider, source.Parser, source.Options...)
+		err = loadSource(k, source, nil)
 		if err != nil {
 			if result != nil {
 				result = fmt.Errorf("%s: %s", result.Error(), err.Error())
@@ -463,7 +594,9 @@ func readConfig(k *koanf.Koanf, sources ...configLoader) error {
 // Run is the primary external function of this library. It augments the
 // cli.Command with default command-line flags, hooks in handling for
 // processing a configuration, runs the appropriate Action, calls the
-// terminator to wait for goroutine cleanup
+// terminator to wait for goroutine cleanup. While the command runs, secret
+// configuration values are removed from the default slog logger, and from
+// trace entries written to the ErrWriter of the command
 func Run(ctx context.Context, command *cli.Command, options ...Option) {
 	var err error
 	flags.inuse = set.NewSet(
@@ -482,15 +615,25 @@ func Run(ctx context.Context, command *cli.Command, options ...Option) {
 			os.Exit(1)
 		}
 	}
+	// Cross-field rules can only be checked once the configuration struct is known
+	if err = checkConfigRules(); err != nil {
+		logger.Error("Error executing Run() options", "error", err.Error())
+		os.Exit(1)
+	}
 	// No use for a --config flag if Configuration() wasn't used
 	if configuration == nil {
 		flags.Delete("config")
+		flags.Delete("config-key-file")
 	}
 	// Add on default flags that have not been scrapped
 	addFlags(command, flags.InUse())
 	// Add a "version" command. Thus seems to be required since we supply
 	// our own printVersion function
 	addCommand(command, version)
+	// Add a "config" command if any Options provided subcommands for it
+	if configuration != nil && len(configCommands) > 0 {
+		addCommand(command, configCommand())
+	}
 	// Hook in the actions that need to happen after the command line is
 	// processed but before the Action code is executed
 	command.Before = before
@@ -509,11 +652,13 @@ func Run(ctx context.Context, command *cli.Command, options ...Option) {
 		}
 	}
 	if command.Root().ErrWriter != nil {
+		// Secret values are removed from trace entries written here. A
+		// destination chosen by the program itself is left as it is
 		err = logger.Configure(
 			logger.ConfigSetting{
 				AppliesTo: logger.Tracy,
 				Key:       logger.DestinationSetting,
-				Value:     command.Root().ErrWriter,
+				Value:     redactingWriter{command.Root().ErrWriter},
 			},
 		)
 		if err != nil {
@@ -521,11 +666,51 @@ func Run(ctx context.Context, command *cli.Command, options ...Option) {
 			os.Exit(1)
 		}
 	}
+	runArgs = os.Args
 	err = command.Run(ctx, os.Args)
+	restoreLogs()
+	stopWatching()
+	stopSignals()
+	// Failures of validate tag rules are attributed to their sources
+	// before the record of where each value came from is reset
+	var (
+		problems []validationProblem
+		verrs    ValidationErrors
+	)
+	if errors.As(err, &verrs) {
+		problems = validationProblems(verrs)
+	}
 	configuration = nil // Required for the ExampleConfig* tests to pass
+	pristine = nil
+	discoveryName = ""
+	envConfig = nil
+	interpolation = false
+	resetSecrets()
+	secretProviders = builtinSecretProviders()
+	encryption = nil
+	configCommands = nil
+	configRules = nil
+	strict = strictOff
+	publish(nil)
+	reloadState = nil
+	reloadListeners = nil
+	watchFiles = false
+	reloadOnSignal = false
+	signalReopeners = nil
+	staticWarnOnly = false
+	standaloneCommands.Clear()
+	runArgs = nil
+	resetOrigins()
 	terminator.Wait()
 	if err != nil && !strings.Contains(err.Error(), "flag provided but not defined") {
-		logger.Error("Error performing command", "error", err.Error(), "command", command.FullName())
+		if len(problems) > 0 && command.Bool("json") {
+			logger.Error("Error performing command", "error", err.Error(), "errors", problems, "command", command.FullName())
+		} else {
+			logger.Error("Error performing command", "error", err.Error(), "command", command.FullName())
+			for _, problem := range problems {
+				logger.Error("Invalid configuration", "problem", problem.String())
+			}
+		}
 		if !noOsExit {
 			os.Exit(1)
 		}
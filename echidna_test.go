@@ -442,6 +442,85 @@ func Test_before(t *testing.T) {
 	}
 }
 
+func Test_before_noConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config
+		line    []string
+		flags   bool
+		wantI   int
+		wantErr bool
+	}{
+		{
+			name:  "valid-defaults",
+			cfg:   config{I: 33},
+			line:  []string{"test"},
+			wantI: 33,
+		},
+		{
+			name:    "invalid-defaults",
+			cfg:     config{I: 0},
+			line:    []string{"test"},
+			wantErr: true,
+		},
+		{
+			name:  "flag-override",
+			cfg:   config{I: 0},
+			line:  []string{"test", "-i", "33"},
+			flags: true,
+			wantI: 33,
+		},
+		{
+			name:    "invalid-flag-override",
+			cfg:     config{I: 33},
+			line:    []string{"test", "-i", "34"},
+			flags:   true,
+			wantErr: true,
+		},
+		{
+			name:  "version-not-validated",
+			cfg:   config{I: 0},
+			line:  []string{"test", "version"},
+			wantI: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg
+			cmd := &cli.Command{
+				Name: "test",
+				Action: func(context.Context, *cli.Command) error {
+					return nil
+				},
+				Before:   before,
+				Commands: []*cli.Command{version},
+				Flags: []cli.Flag{
+					&cli.StringSliceFlag{
+						Name: "config",
+					},
+				},
+			}
+			if tt.flags {
+				if err := ConfigFlags([]Configurator{&cfg}, cmd)(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			configuration = &cfg
+			buf := &bytes.Buffer{}
+			cmd.Writer = buf
+			cmd.ErrWriter = buf
+			err := cmd.Run(context.Background(), tt.line)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("before() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && cfg.I != tt.wantI {
+				t.Errorf("before() I = %v, want %v", cfg.I, tt.wantI)
+			}
+			configuration = nil
+		})
+	}
+}
+
 func Test_configure(t *testing.T) {
 	type args struct {
 		config        Configurator
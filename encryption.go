@@ -0,0 +1,302 @@
+// Copyright © 2024 Bruce Smith <bruceesmith@gmail.com>
+// Use of this source code is governed by the MIT
+// License that can be found in the LICENSE file.
+
+package echidna
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/knadh/koanf/providers/confmap"
+	"github.com/knadh/koanf/v2"
+	"github.com/urfave/cli/v3"
+)
+
+const (
+	// encryptedPrefix and encryptedSuffix surround an encrypted configuration value
+	encryptedPrefix = "ENC[aes256-gcm,"
+	encryptedSuffix = "]"
+)
+
+// encryptionKey describes where the key for encrypted configuration values is found
+type encryptionKey struct {
+	file     string // Set by ConfigEncryption
+	env      string // Set by ConfigEncryption
+	flagFile string // Set from --config-key-file
+}
+
+var (
+	// encryption is the source of the configuration key, or nil
+	// if ConfigEncryption() was not used
+	encryption *encryptionKey
+)
+
+// ConfigEncryption is an Option which allows individual configuration values to
+// be encrypted, in the form
+//
+//	password: ENC[aes256-gcm,<base64 nonce and ciphertext>]
+//
+// Encrypted values are decrypted as soon as the configuration sources are read,
+// and are treated as secrets thereafter. The key is 32 bytes, base64 encoded
+// (as generated by "openssl rand -base64 32"), and is read from the first of:
+//   - the file named by the --config-key-file flag, which this Option adds
+//   - the environment variable keyEnv, if it is non-empty and set
+//   - the file keyFile, if it is non-empty
+//
+// Each value is bound to its key, so an encrypted value cannot be decrypted
+// once it has been moved to another key.
+//
+// The Option also adds the subcommand "config encrypt", which encrypts the values
+// of selected keys within a configuration file in place. Only the encrypted values
+// are rewritten in JSON, YAML, TOML, .properties and .env files, so that comments,
+// key order and formatting are kept
+func ConfigEncryption(keyFile, keyEnv string) Option {
+	return func() error {
+		encryption = &encryptionKey{
+			file: keyFile,
+			env:  keyEnv,
+		}
+		flags.all["config-key-file"] = &cli.StringFlag{
+			Name:  "config-key-file",
+			Usage: "path to the key used to decrypt encrypted configuration values",
+		}
+		flags.inuse.Add("config-key-file")
+		addConfigCommand(encryptCommand(), true)
+		return nil
+	}
+}
+
+// key reads and decodes the encryption key
+func (e *encryptionKey) key() ([]byte, error) {
+	var (
+		encoded []byte
+		err     error
+	)
+	switch {
+	case e.flagFile != "":
+		encoded, err = os.ReadFile(e.flagFile)
+	case e.env != "" && os.Getenv(e.env) != "":
+		encoded = []byte(os.Getenv(e.env))
+	case e.file != "":
+		encoded, err = os.ReadFile(e.file)
+	default:
+		return nil, errors.New("no configuration key was provided")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the configuration key: [%w]", err)
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+	if err != nil {
+		return nil, fmt.Errorf("configuration key is not base64 encoded: [%w]", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("configuration key must be 32 bytes, not %d", len(key))
+	}
+	return key, nil
+}
+
+// isEncrypted reports whether a configuration value is encrypted
+func isEncrypted(s string) bool {
+	return strings.HasPrefix(s, encryptedPrefix) && strings.HasSuffix(s, encryptedSuffix)
+}
+
+// encryptValue encrypts the value of a configuration key with AES-256-GCM.
+// The path of the key is authenticated along with the value
+func encryptValue(key []byte, path, plaintext string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), []byte(path))
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed) + encryptedSuffix, nil
+}
+
+// decryptValue decrypts the value of a configuration key encrypted by encryptValue
+func decryptValue(key []byte, path, value string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimSuffix(strings.TrimPrefix(value, encryptedPrefix), encryptedSuffix))
+	if err != nil {
+		return "", fmt.Errorf("encrypted value is not base64 encoded: [%w]", err)
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", errors.New("encrypted value is too short")
+	}
+	plaintext, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], []byte(path))
+	if err != nil {
+		return "", errors.New("encrypted value could not be decrypted with the configuration key, or was encrypted for another key")
+	}
+	return string(plaintext), nil
+}
+
+// newGCM returns an AES-GCM cipher for a key
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// decryptValues returns a copy of a configuration in which every encrypted
+// value has been decrypted. The key is only read if there is such a value
+func decryptValues(k *koanf.Koanf) (*koanf.Koanf, error) {
+	var key []byte
+	decrypted, err := walkStrings(k.Raw(), "", func(path, s string) (any, error) {
+		if !isEncrypted(s) {
+			return s, nil
+		}
+		if key == nil {
+			var err error
+			if key, err = encryption.key(); err != nil {
+				return nil, err
+			}
+		}
+		plaintext, err := decryptValue(key, path, s)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		secretKeys.Add(path)
+		return plaintext, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	result := koanf.New(".")
+	err = result.Load(confmap.Provider(decrypted, ""), nil)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// encryptCommand returns the "config encrypt" subcommand
+func encryptCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "encrypt",
+		Usage:     "encrypt the values of keys in a configuration file",
+		ArgsUsage: "FILE",
+		Flags: []cli.Flag{
+			&cli.StringSliceFlag{
+				Name:     "keys",
+				Usage:    "comma-separated list of the configuration keys to encrypt",
+				Required: true,
+			},
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			if cmd.Args().Len() != 1 {
+				return fmt.Errorf("config encrypt requires a single configuration file")
+			}
+			encryption.flagFile = cmd.String("config-key-file")
+			return encryptFile(cmd.Args().First(), cmd.StringSlice("keys"))
+		},
+	}
+}
+
+// encryptFile encrypts the values of the nominated keys within a
+// configuration file. Only those values are rewritten, unless the format
+// of the file does not allow it, when the whole file is written again
+func encryptFile(path string, keys []string) error {
+	if _, source := splitFormat(path); source == "-" {
+		return errors.New("standard input cannot be encrypted in place")
+	}
+	ls, err := loaders([]string{path})
+	if err != nil {
+		return err
+	}
+	_, path = splitFormat(path)
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	parser := ls[0].Parser
+	if _, ok := parser.(sniffer); ok {
+		if parser, err = sniff(b); err != nil {
+			return err
+		}
+	}
+	mp, err := parser.Unmarshal(b)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: [%w]", path, err)
+	}
+	key, err := encryption.key()
+	if err != nil {
+		return err
+	}
+	k := koanf.New(".")
+	if err = k.Load(confmap.Provider(mp, ""), nil); err != nil {
+		return err
+	}
+	var (
+		edits    []textEdit
+		inPlace  = true
+		original = k.Raw()
+	)
+	for _, name := range keys {
+		if !k.Exists(name) {
+			return fmt.Errorf("%s has no key %s", path, name)
+		}
+		switch v := k.Get(name).(type) {
+		case map[string]any, []any:
+			return fmt.Errorf("%s is not a single value and cannot be encrypted", name)
+		case string:
+			if isEncrypted(v) {
+				continue
+			}
+		}
+		encrypted, err := encryptValue(key, name, fmt.Sprint(k.Get(name)))
+		if err != nil {
+			return err
+		}
+		if err = k.Set(name, encrypted); err != nil {
+			return err
+		}
+		if !inPlace {
+			continue
+		}
+		edit, err := stringEdit(parser, b, name, encrypted)
+		switch {
+		case errors.Is(err, errNotEditable):
+			inPlace = false
+		case err != nil:
+			return fmt.Errorf("%s: %w", path, err)
+		default:
+			edits = append(edits, edit)
+		}
+	}
+	if reflect.DeepEqual(k.Raw(), original) {
+		return nil
+	}
+	var out []byte
+	if inPlace {
+		if out, err = applyEdits(b, edits); err != nil {
+			return fmt.Errorf("failed to write %s: [%w]", path, err)
+		}
+		// The edited file must hold exactly the encrypted configuration
+		if edited, err := parser.Unmarshal(out); err != nil || !reflect.DeepEqual(edited, k.Raw()) {
+			return fmt.Errorf("failed to write %s: the encrypted values could not be written in place", path)
+		}
+	} else if out, err = parser.Marshal(k.Raw()); err != nil {
+		return fmt.Errorf("failed to write %s: [%w]", path, err)
+	}
+	return os.WriteFile(path, out, info.Mode().Perm())
+}
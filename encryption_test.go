@@ -0,0 +1,249 @@
+// Copyright © 2024 Bruce Smith <bruceesmith@gmail.com>
+// Use of this source code is governed by the MIT
+// License that can be found in the LICENSE file.
+
+package echidna
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli/v3"
+)
+
+// testKey writes a base64 encoded configuration key to a file
+func testKey(t *testing.T, fill byte) (string, []byte) {
+	t.Helper()
+	key := bytes.Repeat([]byte{fill}, 32)
+	path := filepath.Join(t.TempDir(), "key")
+	if err := os.WriteFile(path, []byte(base64.StdEncoding.EncodeToString(key)+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path, key
+}
+
+func Test_encryptValue(t *testing.T) {
+	_, key := testKey(t, 1)
+	_, other := testKey(t, 2)
+	encrypted, err := encryptValue(key, "db.password", "hunter2")
+	if err != nil {
+		t.Fatalf("encryptValue() error = %v", err)
+	}
+	if !isEncrypted(encrypted) || strings.Contains(encrypted, "hunter2") {
+		t.Errorf("encryptValue() = %v, not an encrypted value", encrypted)
+	}
+	tests := []struct {
+		name    string
+		key     []byte
+		path    string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "ok",
+			key:   key,
+			path:  "db.password",
+			value: encrypted,
+			want:  "hunter2",
+		},
+		{
+			name:    "wrong-key",
+			key:     other,
+			path:    "db.password",
+			value:   encrypted,
+			wantErr: true,
+		},
+		{
+			name:    "moved",
+			key:     key,
+			path:    "api.token",
+			value:   encrypted,
+			wantErr: true,
+		},
+		{
+			name:    "not-base64",
+			key:     key,
+			path:    "db.password",
+			value:   encryptedPrefix + "!!!" + encryptedSuffix,
+			wantErr: true,
+		},
+		{
+			name:    "short",
+			key:     key,
+			path:    "db.password",
+			value:   encryptedPrefix + "YWJj" + encryptedSuffix,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decryptValue(tt.key, tt.path, tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("decryptValue() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("decryptValue() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_encryptionKey_key(t *testing.T) {
+	flagFile, flagKey := testKey(t, 1)
+	file, fileKey := testKey(t, 2)
+	_, envKey := testKey(t, 3)
+	bad := filepath.Join(t.TempDir(), "bad")
+	if err := os.WriteFile(bad, []byte(base64.StdEncoding.EncodeToString([]byte("short"))), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("ECHIDNA_KEY", base64.StdEncoding.EncodeToString(envKey))
+	t.Setenv("ECHIDNA_NOT_BASE64", "not base64!")
+	tests := []struct {
+		name    string
+		e       encryptionKey
+		want    []byte
+		wantErr bool
+	}{
+		{
+			name: "flag",
+			e:    encryptionKey{file: file, env: "ECHIDNA_KEY", flagFile: flagFile},
+			want: flagKey,
+		},
+		{
+			name: "env",
+			e:    encryptionKey{file: file, env: "ECHIDNA_KEY"},
+			want: envKey,
+		},
+		{
+			name: "file",
+			e:    encryptionKey{file: file, env: "ECHIDNA_UNSET_KEY"},
+			want: fileKey,
+		},
+		{
+			name:    "none",
+			e:       encryptionKey{},
+			wantErr: true,
+		},
+		{
+			name:    "missing-file",
+			e:       encryptionKey{file: "/no/such/key"},
+			wantErr: true,
+		},
+		{
+			name:    "not-base64",
+			e:       encryptionKey{env: "ECHIDNA_NOT_BASE64"},
+			wantErr: true,
+		},
+		{
+			name:    "wrong-length",
+			e:       encryptionKey{file: bad},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.e.key()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("encryptionKey.key() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("encryptionKey.key() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_configEncrypt(t *testing.T) {
+	keyFile, _ := testKey(t, 7)
+	path := filepath.Join(t.TempDir(), "app.yml")
+	if err := os.WriteFile(path, []byte("# the answer\ni: 33 # inline\ndb:\n  password: hunter2\n  host: localhost\n"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	var cfg config
+	configuration = &cfg
+	configloaders = DefaultLoaders()
+	if err := ConfigEncryption("", "")(); err != nil {
+		t.Fatalf("ConfigEncryption() error = %v", err)
+	}
+	defer func() {
+		configuration = nil
+		configloaders = nil
+		encryption = nil
+		configCommands = nil
+		standaloneCommands.Clear()
+		resetSecrets()
+	}()
+	newCommand := func() *cli.Command {
+		return &cli.Command{
+			Name:   "test",
+			Before: before,
+			Action: func(context.Context, *cli.Command) error {
+				return nil
+			},
+			Flags: []cli.Flag{
+				&cli.StringSliceFlag{Name: "config"},
+				&cli.StringFlag{Name: "config-key-file"},
+			},
+			Commands:  []*cli.Command{configCommand()},
+			Writer:    &bytes.Buffer{},
+			ErrWriter: &bytes.Buffer{},
+		}
+	}
+
+	// Encrypting runs without loading the configuration, which cannot yet be read
+	args := []string{"test", "--config-key-file", keyFile, "--config", "/no/such/file.yml", "config", "encrypt", "--keys", "db.password,i", path}
+	if err := newCommand().Run(context.Background(), args); err != nil {
+		t.Fatalf("config encrypt error = %v", err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only the encrypted values are rewritten
+	want := "# the answer\ni: X # inline\ndb:\n  password: X\n  host: localhost\n"
+	if got := regexp.MustCompile(`"ENC\[aes256-gcm,[^\]]+\]"`).ReplaceAllString(string(b), "X"); got != want {
+		t.Errorf("config encrypt wrote %q, want %q", got, want)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0o640 {
+		t.Errorf("config encrypt changed the file mode to %v", info.Mode().Perm())
+	}
+
+	// Encrypting again leaves the values untouched
+	if err = newCommand().Run(context.Background(), args); err != nil {
+		t.Fatalf("config encrypt error = %v", err)
+	}
+	if again, _ := os.ReadFile(path); !bytes.Equal(again, b) {
+		t.Errorf("config encrypt re-encrypted encrypted values")
+	}
+
+	// The encrypted values are decrypted when the configuration is loaded
+	if err = newCommand().Run(context.Background(), []string{"test", "--config-key-file", keyFile, "--config", path}); err != nil {
+		t.Fatalf("before() with encrypted values error = %v", err)
+	}
+	if cfg.I != 33 {
+		t.Errorf("before() with encrypted values I = %v, want 33", cfg.I)
+	}
+	if !isSecret("db.password") || isSecret("db.host") {
+		t.Errorf("before() did not treat the decrypted values as secrets")
+	}
+
+	// Without the key the configuration cannot be loaded
+	if err = newCommand().Run(context.Background(), []string{"test", "--config", path}); err == nil {
+		t.Errorf("before() without a key succeeded")
+	}
+
+	// Keys must exist, and be single values
+	for _, keys := range []string{"nosuch", "db"} {
+		err = newCommand().Run(context.Background(), []string{"test", "--config-key-file", keyFile, "config", "encrypt", "--keys", keys, path})
+		if err == nil {
+			t.Errorf("config encrypt --keys %s succeeded", keys)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright © 2024 Bruce Smith <bruceesmith@gmail.com>
+// Use of this source code is governed by the MIT
+// License that can be found in the LICENSE file.
+
+package echidna
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/knadh/koanf/providers/env"
+	"github.com/knadh/koanf/v2"
+)
+
+// envSource describes how environment variables are mapped onto
+// configuration keys by [ConfigEnv]
+type envSource struct {
+	prefix, separator string
+}
+
+var (
+	// envConfig is the environment variable source of the configuration, or
+	// nil if ConfigEnv() was not used
+	envConfig *envSource
+)
+
+// ConfigEnv is an Option which loads the whole configuration, not just the
+// fields bound to command-line flags, from environment variables whose names
+// start with prefix. The remainder of each name is lower-cased, and separator
+// (which defaults to "__") divides the levels of nesting. For example, with
+// a prefix of "APP_":
+//
+//	APP_DATABASE__POOL_SIZE=10  sets  database.pool_size
+//
+// Comma-separated values are accepted for slices ("a,b,c") and maps
+// ("k1=v1,k2=v2"), and byte sizes ("10MB") for integers. Values from the environment override those from the
+// configuration sources given by --config, and are themselves overridden
+// by command-line flags
+func ConfigEnv(prefix, separator string) Option {
+	return func() error {
+		if prefix == "" {
+			return fmt.Errorf("ConfigEnv requires a non-empty environment variable prefix")
+		}
+		if separator == "" {
+			separator = "__"
+		}
+		envConfig = &envSource{
+			prefix:    prefix,
+			separator: separator,
+		}
+		return nil
+	}
+}
+
+// envLoader returns a configuration loader which reads environment
+// variables into the configuration
+func (e *envSource) envLoader() configLoader {
+	return configLoader{
+		Provider: env.ProviderWithValue(e.prefix, ".", func(name, value string) (string, any) {
+			key := e.key(name)
+			recordOrigin(key, Origin{Kind: OriginEnv, Source: name})
+			return key, value
+		}),
+		Parser:  nil,
+		Options: slices.Concat([]koanf.Option{}, mergeOptions()),
+	}
+}
+
+// key converts the name of an environment variable into a configuration key
+func (e *envSource) key(name string) string {
+	name = strings.ToLower(strings.TrimPrefix(name, e.prefix))
+	return strings.ReplaceAll(name, strings.ToLower(e.separator), ".")
+}
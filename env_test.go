@@ -0,0 +1,149 @@
+// Copyright © 2024 Bruce Smith <bruceesmith@gmail.com>
+// Use of this source code is governed by the MIT
+// License that can be found in the LICENSE file.
+
+package echidna
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/urfave/cli/v3"
+)
+
+type envDatabase struct {
+	Host     string
+	PoolSize int `koanf:"pool_size"`
+}
+
+type envConfigStruct struct {
+	Database envDatabase
+	Hosts    []string
+	Labels   map[string]string
+	MaxBody  int64  `koanf:"max_body"`
+	Internal string `flag:"-"`
+}
+
+func (e *envConfigStruct) Validate() error { return nil }
+
+func TestConfigEnv(t *testing.T) {
+	tests := []struct {
+		name          string
+		prefix        string
+		separator     string
+		wantSeparator string
+		wantErr       bool
+	}{
+		{
+			name:          "ok",
+			prefix:        "APP_",
+			separator:     "_x_",
+			wantSeparator: "_x_",
+		},
+		{
+			name:          "default-separator",
+			prefix:        "APP_",
+			wantSeparator: "__",
+		},
+		{
+			name:    "no-prefix",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ConfigEnv(tt.prefix, tt.separator)()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ConfigEnv() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (envConfig.prefix != tt.prefix || envConfig.separator != tt.wantSeparator) {
+				t.Errorf("ConfigEnv() = %+v", *envConfig)
+			}
+			envConfig = nil
+		})
+	}
+}
+
+func Test_envSource_key(t *testing.T) {
+	tests := []struct {
+		name string
+		env  envSource
+		in   string
+		want string
+	}{
+		{
+			name: "nested",
+			env:  envSource{prefix: "APP_", separator: "__"},
+			in:   "APP_DATABASE__POOL_SIZE",
+			want: "database.pool_size",
+		},
+		{
+			name: "top-level",
+			env:  envSource{prefix: "APP_", separator: "__"},
+			in:   "APP_HOSTS",
+			want: "hosts",
+		},
+		{
+			name: "custom-separator",
+			env:  envSource{prefix: "MY", separator: "_"},
+			in:   "MY_SERVER_PORT",
+			want: ".server.port",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.env.key(tt.in); got != tt.want {
+				t.Errorf("envSource.key() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_before_configEnv(t *testing.T) {
+	t.Setenv("ECHIDNA_TEST_DATABASE__HOST", "db.example.com")
+	t.Setenv("ECHIDNA_TEST_DATABASE__POOL_SIZE", "20")
+	t.Setenv("ECHIDNA_TEST_HOSTS", "a,b")
+	t.Setenv("ECHIDNA_TEST_LABELS", "env=prod,tier=web")
+	t.Setenv("ECHIDNA_TEST_INTERNAL", "set")
+	t.Setenv("ECHIDNA_TEST_MAX_BODY", "1MiB")
+	var cfg envConfigStruct
+	cmd := &cli.Command{
+		Name:   "test",
+		Before: before,
+		Action: func(context.Context, *cli.Command) error {
+			return nil
+		},
+		Flags: []cli.Flag{
+			&cli.StringSliceFlag{
+				Name: "config",
+			},
+		},
+	}
+	if err := ConfigFlags([]Configurator{&cfg}, cmd)(); err != nil {
+		t.Fatal(err)
+	}
+	configuration = &cfg
+	if err := ConfigEnv("ECHIDNA_TEST_", "")(); err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	cmd.Writer = buf
+	cmd.ErrWriter = buf
+	if err := cmd.Run(context.Background(), []string{"test", "--database-host", "flag.example.com"}); err != nil {
+		t.Fatalf("before() error = %v", err)
+	}
+	want := envConfigStruct{
+		Database: envDatabase{Host: "flag.example.com", PoolSize: 20},
+		Hosts:    []string{"a", "b"},
+		Labels:   map[string]string{"env": "prod", "tier": "web"},
+		MaxBody:  1 << 20,
+		Internal: "set",
+	}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("before() with ConfigEnv = %+v, want %+v", cfg, want)
+	}
+	configuration = nil
+	envConfig = nil
+}
@@ -304,3 +304,90 @@ func ExampleConfigFlags_basicFlagOverride() {
 	// Output:
 	// config is {77}
 }
+
+func ExampleDefaultLoaders() {
+	// Load the configuration from a TOML file using the built-in Loaders
+	//
+	// test.toml simply contains:
+	// i = 33
+	//
+	var (
+		cfg configExample
+		cmd = &cli.Command{
+			Action: func(ctx context.Context, cmd *cli.Command) error {
+				fmt.Println("config is", cfg)
+				return nil
+			},
+			Name:    "defaultloaders",
+			Version: "1",
+		}
+	)
+	os.Args = []string{"defaultloaders", "--config", "testdata/test.toml"}
+	Run(
+		context.Background(),
+		cmd,
+		Configuration(
+			&cfg,
+			DefaultLoaders(),
+		),
+		NoDefaultFlags(),
+	)
+	// Output:
+	// config is {33}
+}
+
+type configDefaults struct {
+	Port int `default:"8080"`
+}
+
+func (c *configDefaults) Validate() error { return nil }
+
+func ExampleConfigFlags_defaultTag() {
+	// A default tag sets a field's value before any configuration
+	// source is loaded, and the default is shown in help
+	//
+	var (
+		cfg configDefaults
+		cmd = &cli.Command{
+			Action: func(ctx context.Context, cmd *cli.Command) error {
+				fmt.Println("config is", cfg)
+				return nil
+			},
+			Name:    "defaulttag",
+			Version: "1",
+		}
+	)
+	os.Args = []string{"defaulttag", "--help"}
+	Run(
+		context.Background(),
+		cmd,
+		Configuration(
+			&cfg,
+			DefaultLoaders(),
+		),
+		ConfigFlags(
+			[]Configurator{&cfg},
+			cmd,
+		),
+		NoDefaultFlags(),
+	)
+	// Output:
+	// NAME:
+	//    defaulttag - A new cli application
+	//
+	// USAGE:
+	//    defaulttag [global options] [command [command options]]
+	//
+	// VERSION:
+	//    1
+	//
+	// COMMANDS:
+	//    version, v  print the version
+	//    help, h     Shows a list of commands or help for one command
+	//
+	// GLOBAL OPTIONS:
+	//    --port value                                                     (default: 8080) [$PORT]
+	//    --config string, --cfg string [ --config string, --cfg string ]  comma-separated list of path(s) to configuration file(s)
+	//    --help, -h                                                       show help
+	//    --version, -v                                                    print the version
+}
@@ -0,0 +1,597 @@
+// Copyright © 2024 Bruce Smith <bruceesmith@gmail.com>
+// Use of this source code is governed by the MIT
+// License that can be found in the LICENSE file.
+
+package echidna
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	// ruleTag is the struct tag, on a field named _, holding
+	// a cross-field validation rule
+	ruleTag = "rule"
+
+	// messageTag is the struct tag, alongside a rule tag, holding
+	// the message reported when the rule is not satisfied
+	messageTag = "message"
+)
+
+// exprType is the type of a value in a rule expression
+type exprType int
+
+const (
+	exprBool exprType = iota
+	exprNumber
+	exprString
+	exprDuration
+)
+
+// crossRule is a boolean expression over configuration keys which
+// a configuration must satisfy
+type crossRule struct {
+	source  string // The expression as written
+	message string // Reported when the rule is not satisfied, if not empty
+}
+
+// exprNode is an element of a parsed rule expression
+type exprNode interface {
+	// check resolves the keys in the expression against a struct
+	// type, and returns the type of the expression's value
+	check(t reflect.Type) (exprType, error)
+	// eval returns the value of the expression for a struct, which is
+	// a bool, a float64 (for numbers and durations) or a string
+	eval(v reflect.Value) any
+}
+
+// exprLiteral is a constant in an expression
+type exprLiteral struct {
+	typ   exprType
+	value any
+}
+
+// exprKey is a configuration key in an expression
+type exprKey struct {
+	key    string
+	index  []int
+	typ    exprType
+	secret bool
+}
+
+// exprUnary is the negation of an expression
+type exprUnary struct {
+	x exprNode
+}
+
+// exprBinary is a comparison or logical operation
+type exprBinary struct {
+	op   string
+	x, y exprNode
+}
+
+// exprToken is a lexical element of an expression
+type exprToken struct {
+	text string
+	kind rune // One of 'k' (key), 'n' (number), 'd' (duration), 's' (string), 'o' (operator) or 0 (end)
+}
+
+// exprParser is a recursive descent parser of rule expressions
+type exprParser struct {
+	tokens []exprToken
+	pos    int
+}
+
+var (
+	// configRules holds the rules added by ConfigRule
+	configRules []crossRule
+
+	// exprOperators are the operators of the expression language, longest first
+	exprOperators = []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "(", ")"}
+
+	// exprTypeNames are the names of expression types, used in error messages
+	exprTypeNames = map[exprType]string{
+		exprBool:     "boolean",
+		exprNumber:   "number",
+		exprString:   "string",
+		exprDuration: "duration",
+	}
+)
+
+// ConfigRule is an Option which adds a cross-field validation rule to the
+// configuration. The rule is a boolean expression over configuration keys,
+// for example
+//
+//	min_workers <= max_workers
+//	!tls.enabled || tls.cert_file != ""
+//	mode == "dev" || (timeout >= 5s && retries > 0)
+//
+// Keys are written as in a configuration file, and can name boolean, number,
+// string and duration fields. Literals are numbers, durations such as 1m30s,
+// strings in double quotes, true and false. The operators are ==, !=, <, <=,
+// >, >=, && (and), || (or) and ! (not), and parentheses group terms. Each
+// side of a comparison must have the same type.
+//
+// The rule is checked against the configuration struct when [Run] starts, and
+// evaluated once the configuration has been loaded, after the validate tags of
+// its fields but before its Validate method. If the rule is not satisfied, the
+// error reports message, if not empty, together with the rule.
+//
+// Rules can also be given in the tags of a field named _, with keys relative to
+// the struct containing the field:
+//
+//	type TLS struct {
+//		_        struct{} `rule:"!enabled || cert_file != \"\"" message:"cert_file is required when TLS is enabled"`
+//		Enabled  bool     `koanf:"enabled"`
+//		CertFile string   `koanf:"cert_file"`
+//	}
+func ConfigRule(expression, message string) Option {
+	return func() error {
+		if _, err := parseExpression(expression); err != nil {
+			return fmt.Errorf("configuration rule %q is invalid: [%w]", expression, err)
+		}
+		configRules = append(configRules, crossRule{source: expression, message: message})
+		return nil
+	}
+}
+
+// checkConfigRules checks the rules added by ConfigRule against the
+// configuration struct
+func checkConfigRules() error {
+	if len(configRules) > 0 && configuration == nil {
+		return errors.New("ConfigRule requires Configuration")
+	}
+	for _, r := range configRules {
+		if _, err := r.compile(reflect.TypeOf(configuration)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// structRules returns the rules in the tags of the fields named _ of a struct type
+func structRules(t reflect.Type) []crossRule {
+	var rules []crossRule
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if field.Name != "_" {
+			continue
+		}
+		if source, ok := field.Tag.Lookup(ruleTag); ok {
+			rules = append(rules, crossRule{source: source, message: field.Tag.Get(messageTag)})
+		}
+	}
+	return rules
+}
+
+// compile parses a rule and checks it against a struct type
+func (r crossRule) compile(t reflect.Type) (exprNode, error) {
+	root, err := parseExpression(r.source)
+	if err == nil {
+		var typ exprType
+		typ, err = root.check(t)
+		if err == nil && typ != exprBool {
+			err = fmt.Errorf("the rule is a %s, not a boolean", exprTypeNames[typ])
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("configuration rule %q is invalid: [%w]", r.source, err)
+	}
+	return root, nil
+}
+
+// evaluate checks that a struct, whose key within the configuration is
+// prefix, satisfies the rule. It returns nil if it does, or else an
+// error whose key is prefix
+func (r crossRule) evaluate(v reflect.Value, prefix string) *FieldError {
+	root, err := r.compile(v.Type())
+	if err != nil {
+		return &FieldError{Key: prefix, Rule: r.source, Message: err.Error()}
+	}
+	if ok, _ := root.eval(v).(bool); ok {
+		return nil
+	}
+	if r.message != "" {
+		return &FieldError{Key: prefix, Rule: r.source, Message: fmt.Sprintf("%s (rule: %s)", r.message, r.source)}
+	}
+	var values []string
+	for _, k := range exprKeys(root) {
+		key := joinKey(prefix, k.key)
+		value := k.format(k.eval(v))
+		if k.secret || isSecret(key) {
+			value = redactedValue
+		}
+		if entry := key + " = " + value; !slices.Contains(values, entry) {
+			values = append(values, entry)
+		}
+	}
+	return &FieldError{
+		Key:     prefix,
+		Rule:    r.source,
+		Message: fmt.Sprintf("rule %s is not satisfied (%s)", r.source, strings.Join(values, ", ")),
+	}
+}
+
+// exprKeys returns the keys within an expression, in the order they appear
+func exprKeys(n exprNode) []*exprKey {
+	switch e := n.(type) {
+	case *exprKey:
+		return []*exprKey{e}
+	case *exprUnary:
+		return exprKeys(e.x)
+	case *exprBinary:
+		return append(exprKeys(e.x), exprKeys(e.y)...)
+	}
+	return nil
+}
+
+// parseExpression converts the text of a rule into an expression tree
+func parseExpression(s string) (exprNode, error) {
+	tokens, err := lexExpression(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{tokens: tokens}
+	n, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != 0 {
+		return nil, fmt.Errorf("unexpected %q", t.text)
+	}
+	return n, nil
+}
+
+// lexExpression splits the text of a rule into tokens
+func lexExpression(s string) ([]exprToken, error) {
+	var tokens []exprToken
+	for i := 0; i < len(s); {
+		c := rune(s[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '"':
+			end := i + 1
+			for end < len(s) && s[end] != '"' {
+				if s[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(s) {
+				return nil, errors.New("unterminated string")
+			}
+			text, err := strconv.Unquote(s[i : end+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid string %s", s[i:end+1])
+			}
+			tokens = append(tokens, exprToken{text: text, kind: 's'})
+			i = end + 1
+		case c >= '0' && c <= '9', c == '-' || c == '.':
+			end := i + 1
+			for end < len(s) && (isWordChar(rune(s[end])) || s[end] == '.') {
+				end++
+			}
+			text := s[i:end]
+			if _, err := strconv.ParseFloat(text, 64); err == nil {
+				tokens = append(tokens, exprToken{text: text, kind: 'n'})
+			} else if _, err := time.ParseDuration(text); err == nil {
+				tokens = append(tokens, exprToken{text: text, kind: 'd'})
+			} else {
+				return nil, fmt.Errorf("invalid number %q", text)
+			}
+			i = end
+		case isWordChar(c):
+			end := i + 1
+			for end < len(s) && (isWordChar(rune(s[end])) || s[end] == '.' || s[end] == '-') {
+				end++
+			}
+			tokens = append(tokens, exprToken{text: s[i:end], kind: 'k'})
+			i = end
+		default:
+			op := ""
+			for _, o := range exprOperators {
+				if strings.HasPrefix(s[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected %q", c)
+			}
+			tokens = append(tokens, exprToken{text: op, kind: 'o'})
+			i += len(op)
+		}
+	}
+	return tokens, nil
+}
+
+// isWordChar reports whether a character can begin a key
+func isWordChar(c rune) bool {
+	return c == '_' || unicode.IsLetter(c) || unicode.IsDigit(c)
+}
+
+// peek returns the next token without consuming it
+func (p *exprParser) peek() exprToken {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return exprToken{text: "end of rule"}
+}
+
+// accept consumes the next token if it is one of the given operators
+func (p *exprParser) accept(ops ...string) (string, bool) {
+	t := p.peek()
+	if t.kind == 'o' && slices.Contains(ops, t.text) {
+		p.pos++
+		return t.text, true
+	}
+	return "", false
+}
+
+// or parses a sequence of terms joined by ||
+func (p *exprParser) or() (exprNode, error) {
+	x, err := p.and()
+	for err == nil {
+		if _, ok := p.accept("||"); !ok {
+			return x, nil
+		}
+		var y exprNode
+		if y, err = p.and(); err == nil {
+			x = &exprBinary{op: "||", x: x, y: y}
+		}
+	}
+	return nil, err
+}
+
+// and parses a sequence of terms joined by &&
+func (p *exprParser) and() (exprNode, error) {
+	x, err := p.unary()
+	for err == nil {
+		if _, ok := p.accept("&&"); !ok {
+			return x, nil
+		}
+		var y exprNode
+		if y, err = p.unary(); err == nil {
+			x = &exprBinary{op: "&&", x: x, y: y}
+		}
+	}
+	return nil, err
+}
+
+// unary parses a term which may be negated
+func (p *exprParser) unary() (exprNode, error) {
+	if _, ok := p.accept("!"); ok {
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &exprUnary{x: x}, nil
+	}
+	return p.comparison()
+}
+
+// comparison parses an operand, optionally compared with another
+func (p *exprParser) comparison() (exprNode, error) {
+	x, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	op, ok := p.accept("==", "!=", "<", "<=", ">", ">=")
+	if !ok {
+		return x, nil
+	}
+	y, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	return &exprBinary{op: op, x: x, y: y}, nil
+}
+
+// operand parses a literal, a key or a parenthesised expression
+func (p *exprParser) operand() (exprNode, error) {
+	if _, ok := p.accept("("); ok {
+		x, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok = p.accept(")"); !ok {
+			return nil, fmt.Errorf("expected ) but found %q", p.peek().text)
+		}
+		return x, nil
+	}
+	t := p.peek()
+	p.pos++
+	switch t.kind {
+	case 's':
+		return &exprLiteral{typ: exprString, value: t.text}, nil
+	case 'n':
+		n, _ := strconv.ParseFloat(t.text, 64)
+		return &exprLiteral{typ: exprNumber, value: n}, nil
+	case 'd':
+		d, _ := time.ParseDuration(t.text)
+		return &exprLiteral{typ: exprDuration, value: float64(d)}, nil
+	case 'k':
+		switch t.text {
+		case "true", "false":
+			return &exprLiteral{typ: exprBool, value: t.text == "true"}, nil
+		}
+		return &exprKey{key: t.text}, nil
+	}
+	p.pos--
+	return nil, fmt.Errorf("expected a key or a value but found %q", t.text)
+}
+
+// check returns the type of the literal
+func (e *exprLiteral) check(_ reflect.Type) (exprType, error) {
+	return e.typ, nil
+}
+
+// eval returns the value of the literal
+func (e *exprLiteral) eval(_ reflect.Value) any {
+	return e.value
+}
+
+// check finds the field named by the key
+func (e *exprKey) check(t reflect.Type) (exprType, error) {
+	e.index, e.secret = nil, false
+	for part := range strings.SplitSeq(e.key, ".") {
+		for t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		if !isNested(t) {
+			return 0, fmt.Errorf("unknown key %s", e.key)
+		}
+		found := false
+		for i := range t.NumField() {
+			if name := keyName(t.Field(i)); name != "" && strings.EqualFold(name, part) {
+				e.index = append(e.index, i)
+				e.secret = e.secret || isSecretField(t.Field(i))
+				t = t.Field(i).Type
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("unknown key %s", e.key)
+		}
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t == durationType:
+		e.typ = exprDuration
+	case t.Kind() == reflect.Bool:
+		e.typ = exprBool
+	case t.Kind() == reflect.String:
+		e.typ = exprString
+	case isNumber(t.Kind()):
+		e.typ = exprNumber
+	default:
+		return 0, fmt.Errorf("key %s is a %s, which cannot be used in a rule", e.key, t)
+	}
+	return e.typ, nil
+}
+
+// eval returns the value of the key's field. A nil pointer
+// along the way yields the zero value of the field
+func (e *exprKey) eval(v reflect.Value) any {
+	for _, i := range e.index {
+		for v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				v = reflect.Zero(v.Type().Elem())
+			} else {
+				v = v.Elem()
+			}
+		}
+		v = v.Field(i)
+	}
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			v = reflect.Zero(v.Type().Elem())
+		} else {
+			v = v.Elem()
+		}
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		return v.Bool()
+	case reflect.String:
+		return v.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint())
+	}
+	return v.Float()
+}
+
+// format returns the value of the key as text for an error message
+func (e *exprKey) format(value any) string {
+	switch e.typ {
+	case exprString:
+		return strconv.Quote(value.(string))
+	case exprDuration:
+		return time.Duration(value.(float64)).String()
+	}
+	return fmt.Sprint(value)
+}
+
+// check verifies that the negated expression is a boolean
+func (e *exprUnary) check(t reflect.Type) (exprType, error) {
+	typ, err := e.x.check(t)
+	if err == nil && typ != exprBool {
+		err = fmt.Errorf("! cannot be applied to a %s", exprTypeNames[typ])
+	}
+	return exprBool, err
+}
+
+// eval negates the expression
+func (e *exprUnary) eval(v reflect.Value) any {
+	return !e.x.eval(v).(bool)
+}
+
+// check verifies that the operands suit the operator
+func (e *exprBinary) check(t reflect.Type) (exprType, error) {
+	xt, err := e.x.check(t)
+	if err != nil {
+		return 0, err
+	}
+	yt, err := e.y.check(t)
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case e.op == "&&" || e.op == "||":
+		if xt != exprBool || yt != exprBool {
+			return 0, fmt.Errorf("%s requires booleans but found a %s and a %s", e.op, exprTypeNames[xt], exprTypeNames[yt])
+		}
+	case xt != yt:
+		return 0, fmt.Errorf("cannot compare a %s with a %s", exprTypeNames[xt], exprTypeNames[yt])
+	case xt == exprBool && e.op != "==" && e.op != "!=":
+		return 0, fmt.Errorf("%s cannot be applied to booleans", e.op)
+	}
+	return exprBool, nil
+}
+
+// eval applies the operator
+func (e *exprBinary) eval(v reflect.Value) any {
+	switch e.op {
+	case "&&":
+		return e.x.eval(v).(bool) && e.y.eval(v).(bool)
+	case "||":
+		return e.x.eval(v).(bool) || e.y.eval(v).(bool)
+	}
+	x, y := e.x.eval(v), e.y.eval(v)
+	switch e.op {
+	case "==":
+		return x == y
+	case "!=":
+		return x != y
+	}
+	var c int
+	switch xv := x.(type) {
+	case float64:
+		c = cmp.Compare(xv, y.(float64))
+	case string:
+		c = cmp.Compare(xv, y.(string))
+	}
+	switch e.op {
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	}
+	return c >= 0
+}
@@ -0,0 +1,172 @@
+// Copyright © 2024 Bruce Smith <bruceesmith@gmail.com>
+// Use of this source code is governed by the MIT
+// License that can be found in the LICENSE file.
+
+package echidna
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type exprTLS struct {
+	_        struct{} `rule:"!enabled || cert_file != \"\"" message:"cert_file is required when TLS is enabled"`
+	Enabled  bool     `koanf:"enabled"`
+	CertFile string   `koanf:"cert_file"`
+}
+
+type exprConfig struct {
+	MinWorkers int           `koanf:"min_workers"`
+	MaxWorkers int           `koanf:"max_workers"`
+	Mode       string        `koanf:"mode"`
+	Timeout    time.Duration `koanf:"timeout"`
+	Password   string        `koanf:"password" secret:"true"`
+	Ratio      *float64      `koanf:"ratio"`
+	Hosts      []string      `koanf:"hosts"`
+	TLS        exprTLS       `koanf:"tls"`
+	Listeners  []exprTLS     `koanf:"listeners"`
+}
+
+func (e *exprConfig) Validate() error { return nil }
+
+func Test_crossRule_compile(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    string
+		wantErr bool
+	}{
+		{name: "comparison", rule: "min_workers <= max_workers"},
+		{name: "logic", rule: `!(mode == "dev") && (timeout >= 1m30s || tls.enabled)`},
+		{name: "literals", rule: `ratio > -0.5 && mode != "a \"quoted\" value" && tls.enabled == true`},
+		{name: "case-insensitive", rule: "MIN_WORKERS > 0"},
+		{name: "unknown-key", rule: "min_worker > 0", wantErr: true},
+		{name: "unusable-key", rule: "hosts == 1", wantErr: true},
+		{name: "mismatch", rule: "timeout > 5", wantErr: true},
+		{name: "not-boolean", rule: "min_workers", wantErr: true},
+		{name: "not-on-number", rule: "!min_workers", wantErr: true},
+		{name: "and-on-string", rule: `mode && tls.enabled`, wantErr: true},
+		{name: "ordered-booleans", rule: "tls.enabled < true", wantErr: true},
+		{name: "unbalanced", rule: "(min_workers > 0", wantErr: true},
+		{name: "trailing", rule: "min_workers > 0 max_workers", wantErr: true},
+		{name: "missing-operand", rule: "min_workers >", wantErr: true},
+		{name: "bad-number", rule: "min_workers > 5x", wantErr: true},
+		{name: "unterminated", rule: `mode == "dev`, wantErr: true},
+		{name: "bad-character", rule: "min_workers = 1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := crossRule{source: tt.rule}.compile(reflect.TypeFor[*exprConfig]())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("crossRule.compile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_crossRule_evaluate(t *testing.T) {
+	ratio := 0.25
+	cfg := &exprConfig{
+		MinWorkers: 8,
+		MaxWorkers: 4,
+		Mode:       "prod",
+		Timeout:    time.Minute,
+		Password:   "hunter22",
+		Ratio:      &ratio,
+	}
+	tests := []struct {
+		name string
+		rule crossRule
+		want *FieldError
+	}{
+		{
+			name: "satisfied",
+			rule: crossRule{source: `mode == "prod" && timeout < 2m && ratio >= 0.25`},
+		},
+		{
+			name: "values",
+			rule: crossRule{source: "min_workers <= max_workers"},
+			want: &FieldError{
+				Rule:    "min_workers <= max_workers",
+				Message: "rule min_workers <= max_workers is not satisfied (min_workers = 8, max_workers = 4)",
+			},
+		},
+		{
+			name: "formatted",
+			rule: crossRule{source: `mode == "dev" || timeout > 1h || password == ""`},
+			want: &FieldError{
+				Rule:    `mode == "dev" || timeout > 1h || password == ""`,
+				Message: `rule mode == "dev" || timeout > 1h || password == "" is not satisfied (mode = "prod", timeout = 1m0s, password = [REDACTED])`,
+			},
+		},
+		{
+			name: "message",
+			rule: crossRule{source: "max_workers >= 8", message: "at least 8 workers are needed"},
+			want: &FieldError{
+				Rule:    "max_workers >= 8",
+				Message: "at least 8 workers are needed (rule: max_workers >= 8)",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rule.evaluate(reflect.ValueOf(cfg), ""); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("crossRule.evaluate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_validateConfig_rules(t *testing.T) {
+	if err := checkRuleTags(&exprConfig{}); err != nil {
+		t.Fatalf("checkRuleTags() error = %v", err)
+	}
+	if err := checkRuleTags(&struct {
+		_ struct{} `rule:"missing > 0"`
+	}{}); err == nil {
+		t.Errorf("checkRuleTags() accepted a rule with an unknown key")
+	}
+
+	configRules = []crossRule{{source: "min_workers <= max_workers"}}
+	defer func() { configRules = nil }()
+	cfg := &exprConfig{
+		MinWorkers: 2,
+		MaxWorkers: 1,
+		TLS:        exprTLS{Enabled: true},
+		Listeners:  []exprTLS{{Enabled: true, CertFile: "a.pem"}, {Enabled: true}},
+	}
+	want := ValidationErrors{
+		{Key: "tls", Rule: `!enabled || cert_file != ""`, Message: `cert_file is required when TLS is enabled (rule: !enabled || cert_file != "")`},
+		{Key: "listeners[1]", Rule: `!enabled || cert_file != ""`, Message: `cert_file is required when TLS is enabled (rule: !enabled || cert_file != "")`},
+		{Rule: "min_workers <= max_workers", Message: "rule min_workers <= max_workers is not satisfied (min_workers = 2, max_workers = 1)"},
+	}
+	var got ValidationErrors
+	if !errors.As(validateConfig(cfg), &got) || !reflect.DeepEqual(got, want) {
+		t.Errorf("validateConfig() = %v, want %v", got, want)
+	}
+}
+
+func Test_checkConfigRules(t *testing.T) {
+	defer func() {
+		configuration = nil
+		configRules = nil
+	}()
+	if err := ConfigRule("min_workers <", "")(); err == nil {
+		t.Errorf("ConfigRule() accepted an incomplete rule")
+	}
+	if err := ConfigRule("min_workers < max_workers", "")(); err != nil {
+		t.Fatalf("ConfigRule() error = %v", err)
+	}
+	if err := checkConfigRules(); err == nil {
+		t.Errorf("checkConfigRules() without Configuration did not fail")
+	}
+	configuration = &exprConfig{}
+	if err := checkConfigRules(); err != nil {
+		t.Errorf("checkConfigRules() error = %v", err)
+	}
+	configRules = append(configRules, crossRule{source: "min_workers < timeout"})
+	if err := checkConfigRules(); err == nil {
+		t.Errorf("checkConfigRules() accepted a mismatched comparison")
+	}
+}
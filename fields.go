@@ -0,0 +1,230 @@
+// Copyright © 2024 Bruce Smith <bruceesmith@gmail.com>
+// Use of this source code is governed by the MIT
+// License that can be found in the LICENSE file.
+
+package echidna
+
+import (
+	"encoding"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-viper/mapstructure/v2"
+	"github.com/knadh/koanf/v2"
+)
+
+// configField is a leaf field of a configuration struct, identified
+// by its koanf key path (for example "server.tls.cert_file")
+type configField struct {
+	Key   string
+	Field reflect.StructField
+	Value reflect.Value
+}
+
+var (
+	// textUnmarshaler is the type of the encoding.TextUnmarshaler interface
+	textUnmarshaler = reflect.TypeFor[encoding.TextUnmarshaler]()
+
+	// sizePattern matches a byte size such as "10MB", "1.5 GiB" or "512k"
+	sizePattern = regexp.MustCompile(`^([0-9]+(?:\.[0-9]+)?)\s*([a-zA-Z]+)$`)
+
+	// sizeUnits holds the number of bytes in each unit of a byte size, with
+	// decimal and binary multiples. Units are matched without regard to case
+	sizeUnits = map[string]float64{
+		"b":   1,
+		"k":   1 << 10,
+		"kb":  1e3,
+		"kib": 1 << 10,
+		"m":   1 << 20,
+		"mb":  1e6,
+		"mib": 1 << 20,
+		"g":   1 << 30,
+		"gb":  1e9,
+		"gib": 1 << 30,
+		"t":   1 << 40,
+		"tb":  1e12,
+		"tib": 1 << 40,
+		"p":   1 << 50,
+		"pb":  1e15,
+		"pib": 1 << 50,
+	}
+)
+
+// configFields returns every leaf field of a configuration struct, descending
+// into nested structs. The argument is either a struct or a pointer to one
+func configFields(v reflect.Value) []configField {
+	if v.Kind() == reflect.Pointer {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+	var result []configField
+	walkFields(v, "", &result)
+	return result
+}
+
+// walkFields is a recursive function which traverses a struct
+// to build a list of its leaf fields
+func walkFields(v reflect.Value, prefix string, result *[]configField) {
+	tipe := v.Type()
+	for i := range tipe.NumField() {
+		field := tipe.Field(i)
+		name := keyName(field)
+		if name == "" {
+			continue
+		}
+		key := name
+		if prefix != "" {
+			key = prefix + "." + name
+		}
+		if isNested(field.Type) {
+			walkFields(v.Field(i), key, result)
+			continue
+		}
+		*result = append(*result, configField{Key: key, Field: field, Value: v.Field(i)})
+	}
+}
+
+// isNested reports whether a field type is a struct whose fields are
+// configured individually, rather than a single value
+func isNested(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && !reflect.PointerTo(t).Implements(textUnmarshaler)
+}
+
+// keyName returns the koanf key of a struct field: the name in its koanf
+// tag, or else its lower-cased field name. Unexported fields and those
+// tagged koanf:"-" have no key
+func keyName(field reflect.StructField) string {
+	if !field.IsExported() {
+		return ""
+	}
+	name, _, _ := strings.Cut(field.Tag.Get("koanf"), ",")
+	switch name {
+	case "-":
+		return ""
+	case "":
+		return strings.ToLower(field.Name)
+	}
+	return name
+}
+
+// decoderConfig returns the mapstructure configuration used to convert
+// configuration values into struct fields
+func decoderConfig() *mapstructure.DecoderConfig {
+	return &mapstructure.DecoderConfig{
+		DecodeHook: mapstructure.ComposeDecodeHookFunc(
+			mapstructure.StringToTimeDurationHookFunc(),
+			mapstructure.TextUnmarshallerHookFunc(),
+			stringToMapHookFunc(),
+			stringToSliceHookFunc(),
+			stringToSizeHookFunc(),
+		),
+		WeaklyTypedInput: true,
+	}
+}
+
+// stringToMapHookFunc converts a string of the form "k1=v1,k2=v2" into a map
+func stringToMapHookFunc() mapstructure.DecodeHookFuncType {
+	return func(f reflect.Type, t reflect.Type, data any) (any, error) {
+		if f.Kind() != reflect.String || t.Kind() != reflect.Map {
+			return data, nil
+		}
+		result := make(map[string]string)
+		raw := strings.TrimSpace(data.(string))
+		if raw == "" {
+			return result, nil
+		}
+		for pair := range strings.SplitSeq(raw, ",") {
+			k, v, found := strings.Cut(pair, "=")
+			if !found {
+				return nil, fmt.Errorf("expected key=value but found %q", pair)
+			}
+			result[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		}
+		return result, nil
+	}
+}
+
+// stringToSliceHookFunc converts a comma-separated string into a slice. Byte
+// slices are excluded, as a string already converts directly to one
+func stringToSliceHookFunc() mapstructure.DecodeHookFuncType {
+	return func(f reflect.Type, t reflect.Type, data any) (any, error) {
+		if f.Kind() != reflect.String || t.Kind() != reflect.Slice || t.Elem().Kind() == reflect.Uint8 {
+			return data, nil
+		}
+		raw := strings.TrimSpace(data.(string))
+		if raw == "" {
+			return []string{}, nil
+		}
+		parts := strings.Split(raw, ",")
+		for i := range parts {
+			parts[i] = strings.TrimSpace(parts[i])
+		}
+		return parts, nil
+	}
+}
+
+// stringToSizeHookFunc converts a byte size, such as "10MB" or "1GiB", into
+// an integer. KB, MB, GB, TB and PB are multiples of 1000, while KiB, MiB,
+// GiB, TiB and PiB, and the single letters K, M, G, T and P, are multiples
+// of 1024. A string without a unit is left to the usual conversion
+func stringToSizeHookFunc() mapstructure.DecodeHookFuncType {
+	return func(f reflect.Type, t reflect.Type, data any) (any, error) {
+		if f.Kind() != reflect.String || t == durationType || !(isInteger(t.Kind()) || isUnsigned(t.Kind())) {
+			return data, nil
+		}
+		match := sizePattern.FindStringSubmatch(strings.TrimSpace(data.(string)))
+		if match == nil {
+			return data, nil
+		}
+		unit, ok := sizeUnits[strings.ToLower(match[2])]
+		if !ok {
+			return nil, fmt.Errorf("unknown unit %q in size %q", match[2], data)
+		}
+		n, err := strconv.ParseFloat(match[1], 64)
+		if err != nil {
+			return nil, err
+		}
+		size := n * unit
+		switch {
+		case size != math.Trunc(size):
+			return nil, fmt.Errorf("size %q is not a whole number of bytes", data)
+		case isUnsigned(t.Kind()) && (size >= math.Exp2(64) || reflect.Zero(t).OverflowUint(uint64(size))):
+			return nil, fmt.Errorf("size %q is too large for %s", data, t)
+		case isInteger(t.Kind()) && (size >= math.Exp2(63) || reflect.Zero(t).OverflowInt(int64(size))):
+			return nil, fmt.Errorf("size %q is too large for %s", data, t)
+		case isUnsigned(t.Kind()):
+			return uint64(size), nil
+		}
+		return int64(size), nil
+	}
+}
+
+// isInteger reports whether a kind is a signed integer
+func isInteger(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return true
+	}
+	return false
+}
+
+// isUnsigned reports whether a kind is an unsigned integer
+func isUnsigned(k reflect.Kind) bool {
+	switch k {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	}
+	return false
+}
+
+// unmarshal decodes a koanf configuration into a struct, using
+// the same conversions for values from every source
+func unmarshal(k *koanf.Koanf, out any) error {
+	return k.UnmarshalWithConf("", out, koanf.UnmarshalConf{DecoderConfig: decoderConfig()})
+}
@@ -0,0 +1,200 @@
+// Copyright © 2024 Bruce Smith <bruceesmith@gmail.com>
+// Use of this source code is governed by the MIT
+// License that can be found in the LICENSE file.
+
+package echidna
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/knadh/koanf/providers/confmap"
+	"github.com/knadh/koanf/v2"
+)
+
+type fieldsInner struct {
+	CertFile string `koanf:"cert_file"`
+	Enabled  bool
+}
+
+type fieldsConfig struct {
+	Name    string
+	Port    int `koanf:"port,omitempty"`
+	Skipped int `koanf:"-"`
+	hidden  int
+	TLS     fieldsInner `koanf:"tls"`
+	Started time.Time
+	Tags    []string
+}
+
+func Test_configFields(t *testing.T) {
+	cfg := fieldsConfig{Name: "n", hidden: 1}
+	tests := []struct {
+		name string
+		v    reflect.Value
+		want []string
+	}{
+		{
+			name: "pointer",
+			v:    reflect.ValueOf(&cfg),
+			want: []string{"name", "port", "tls.cert_file", "tls.enabled", "started", "tags"},
+		},
+		{
+			name: "struct",
+			v:    reflect.ValueOf(cfg),
+			want: []string{"name", "port", "tls.cert_file", "tls.enabled", "started", "tags"},
+		},
+		{
+			name: "not-a-struct",
+			v:    reflect.ValueOf(33),
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, f := range configFields(tt.v) {
+				got = append(got, f.Key)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("configFields() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	fields := configFields(reflect.ValueOf(&cfg))
+	fields[0].Value.SetString("changed")
+	if cfg.Name != "changed" {
+		t.Errorf("configFields() values are not addressable through a pointer")
+	}
+}
+
+func Test_unmarshal(t *testing.T) {
+	type target struct {
+		Duration time.Duration
+		List     []string
+		Numbers  []int
+		Bytes    []byte
+		Labels   map[string]string
+		Weights  map[string]int
+		IP       net.IP
+		Size     int64
+		Limit    uint32
+	}
+	tests := []struct {
+		name    string
+		values  map[string]any
+		want    target
+		wantErr bool
+	}{
+		{
+			name: "strings",
+			values: map[string]any{
+				"duration": "1m30s",
+				"list":     "a, b ,c",
+				"numbers":  "1,2,3",
+				"bytes":    "abc",
+				"labels":   "env=prod, tier = web",
+				"weights":  "a=1,b=2",
+				"ip":       "10.0.0.1",
+			},
+			want: target{
+				Duration: 90 * time.Second,
+				List:     []string{"a", "b", "c"},
+				Numbers:  []int{1, 2, 3},
+				Bytes:    []byte("abc"),
+				Labels:   map[string]string{"env": "prod", "tier": "web"},
+				Weights:  map[string]int{"a": 1, "b": 2},
+				IP:       net.ParseIP("10.0.0.1"),
+			},
+		},
+		{
+			name: "native",
+			values: map[string]any{
+				"list":   []any{"x", "y"},
+				"labels": map[string]any{"k": "v"},
+			},
+			want: target{
+				List:   []string{"x", "y"},
+				Labels: map[string]string{"k": "v"},
+			},
+		},
+		{
+			name: "empty",
+			values: map[string]any{
+				"list":   "",
+				"labels": "",
+			},
+			want: target{
+				List:   []string{},
+				Labels: map[string]string{},
+			},
+		},
+		{
+			name: "sizes",
+			values: map[string]any{
+				"size":  "2MiB",
+				"limit": "3 kb",
+			},
+			want: target{
+				Size:  2 << 20,
+				Limit: 3000,
+			},
+		},
+		{
+			name: "plain-size",
+			values: map[string]any{
+				"size":  "42",
+				"limit": 7,
+			},
+			want: target{
+				Size:  42,
+				Limit: 7,
+			},
+		},
+		{
+			name:    "unknown-unit",
+			values:  map[string]any{"size": "10XB"},
+			wantErr: true,
+		},
+		{
+			name:    "fraction-of-a-byte",
+			values:  map[string]any{"size": "1.5B"},
+			wantErr: true,
+		},
+		{
+			name:    "size-overflow",
+			values:  map[string]any{"limit": "5GB"},
+			wantErr: true,
+		},
+		{
+			name:    "negative-size",
+			values:  map[string]any{"limit": "-1KB"},
+			wantErr: true,
+		},
+		{
+			name: "bad-map",
+			values: map[string]any{
+				"labels": "novalue",
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := koanf.New(".")
+			if err := k.Load(confmap.Provider(tt.values, "."), nil); err != nil {
+				t.Fatal(err)
+			}
+			var got target
+			err := unmarshal(k, &got)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unmarshal() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("unmarshal() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,338 @@
+// Copyright © 2024 Bruce Smith <bruceesmith@gmail.com>
+// Use of this source code is governed by the MIT
+// License that can be found in the LICENSE file.
+
+package echidna
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bruceesmith/logger"
+	"github.com/knadh/koanf/v2"
+)
+
+// HTTPSettings determines how the [Loader] returned by [HTTPLoader]
+// fetches configuration sources
+type HTTPSettings struct {
+	// Timeout limits each attempt to fetch a source. The default is 10 seconds
+	Timeout time.Duration
+	// Retries is the number of times a failed attempt is repeated. A request
+	// is repeated only if the server cannot be reached, or responds with
+	// a 5xx status or 429 Too Many Requests
+	Retries int
+	// Backoff is the delay before the first retry, doubled for each retry
+	// after it. The default is half a second
+	Backoff time.Duration
+	// Headers are added to each request. Environment variables in the values
+	// are expanded when the request is made, so that a token need not appear
+	// in the program, e.g. "Authorization": "Bearer ${CONFIG_TOKEN}"
+	Headers map[string]string
+	// MaxSize is the largest configuration, in bytes, which is accepted.
+	// The default is 16 MiB
+	MaxSize int64
+	// CacheDir, if set, is the directory in which a copy of each source is
+	// kept. The copy is revalidated with If-None-Match and If-Modified-Since,
+	// and is used in place of the source when the server cannot be reached
+	CacheDir string
+	// Client is used to make the requests. The default is http.DefaultClient
+	Client *http.Client
+}
+
+// httpProvider is a koanf.Provider which fetches a configuration over
+// HTTP(S), and parses it according to its content type
+type httpProvider struct {
+	url      string
+	settings HTTPSettings
+}
+
+// cachedSource is a copy of a configuration source kept in the cache directory
+type cachedSource struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	ContentType  string `json:"content_type,omitempty"`
+	Body         []byte `json:"body"`
+}
+
+// statusError is an unsuccessful response from the server
+type statusError struct {
+	url    string
+	status string
+	retry  bool
+}
+
+const (
+	defaultHTTPTimeout = 10 * time.Second
+	defaultHTTPBackoff = 500 * time.Millisecond
+	defaultHTTPMaxSize = 16 << 20
+)
+
+// HTTPLoader returns a [Loader] for configuration sources named by an
+// http:// or https:// URL, such as --config https://cfg.internal/app.yaml.
+// The format of a source is taken from the Content-Type of the response
+// if it names one of the formats of [DefaultLoaders], then from the extension
+// of the URL path, and is otherwise determined from the content.
+//
+// An HTTPLoader is not among the [DefaultLoaders], as a configuration fetched
+// from elsewhere has its values interpolated and its secret references
+// resolved like any other, and any configuration file could then include one.
+// To accept URLs, place an HTTPLoader ahead of the defaults:
+//
+//	loaders := append([]echidna.Loader{echidna.HTTPLoader(settings)}, echidna.DefaultLoaders()...)
+func HTTPLoader(settings HTTPSettings) Loader {
+	if settings.Timeout <= 0 {
+		settings.Timeout = defaultHTTPTimeout
+	}
+	if settings.Backoff <= 0 {
+		settings.Backoff = defaultHTTPBackoff
+	}
+	if settings.MaxSize <= 0 {
+		settings.MaxSize = defaultHTTPMaxSize
+	}
+	if settings.Client == nil {
+		settings.Client = http.DefaultClient
+	}
+	return Loader{
+		Provider: func(source string) koanf.Provider {
+			return &httpProvider{url: source, settings: settings}
+		},
+		Match: isURL,
+	}
+}
+
+// isURL reports whether a configuration source is an HTTP(S) URL
+func isURL(source string) bool {
+	lower := strings.ToLower(source)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://")
+}
+
+// Read fetches the configuration and parses it
+func (p *httpProvider) Read() (map[string]any, error) {
+	body, contentType, err := p.fetch()
+	if err != nil {
+		return nil, err
+	}
+	mp, err := p.parser(contentType).Unmarshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", p.redacted(), err)
+	}
+	return mp, nil
+}
+
+// ReadBytes fetches the configuration without parsing it
+func (p *httpProvider) ReadBytes() ([]byte, error) {
+	body, _, err := p.fetch()
+	return body, err
+}
+
+// fetch returns the content of the source and its type, using the cached
+// copy if it has not changed or if the server cannot be reached
+func (p *httpProvider) fetch() ([]byte, string, error) {
+	cached := p.readCache()
+	var err error
+	for attempt := 0; attempt <= p.settings.Retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(p.settings.Backoff << (attempt - 1))
+		}
+		var fetched *cachedSource
+		fetched, err = p.get(cached)
+		if err == nil {
+			if fetched != cached {
+				p.writeCache(fetched)
+			}
+			return fetched.Body, fetched.ContentType, nil
+		}
+		var se *statusError
+		if errors.As(err, &se) && !se.retry {
+			return nil, "", err
+		}
+		logger.Debug("configuration source could not be fetched", "url", p.redacted(), "attempt", attempt+1, "error", err.Error())
+	}
+	if cached != nil {
+		logger.Warn("Using the cached copy of a configuration source", "url", p.redacted(), "error", err.Error())
+		return cached.Body, cached.ContentType, nil
+	}
+	return nil, "", err
+}
+
+// get makes a single request for the source. If the cached copy is still
+// current, it is returned
+func (p *httpProvider) get(cached *cachedSource) (*cachedSource, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), p.settings.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url, nil)
+	if err != nil {
+		return nil, &statusError{url: p.redacted(), status: err.Error()}
+	}
+	for name, value := range p.settings.Headers {
+		req.Header.Set(name, os.ExpandEnv(value))
+	}
+	if cached != nil {
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+	resp, err := p.settings.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cached != nil:
+		return cached, nil
+	case resp.StatusCode == http.StatusOK:
+		body, err := io.ReadAll(io.LimitReader(resp.Body, p.settings.MaxSize+1))
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(body)) > p.settings.MaxSize {
+			return nil, &statusError{url: p.redacted(), status: fmt.Sprintf("larger than %d bytes", p.settings.MaxSize)}
+		}
+		return &cachedSource{
+			URL:          p.url,
+			ETag:         resp.Header.Get("ETag"),
+			LastModified: resp.Header.Get("Last-Modified"),
+			ContentType:  resp.Header.Get("Content-Type"),
+			Body:         body,
+		}, nil
+	}
+	return nil, &statusError{
+		url:    p.redacted(),
+		status: resp.Status,
+		retry:  resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests,
+	}
+}
+
+// parser chooses the parser for the source from its content type, or else
+// from the extension of its path. Loaders provided to Configuration() are
+// preferred over the built-in Loaders
+func (p *httpProvider) parser(contentType string) koanf.Parser {
+	loaders := slices.Concat(configloaders, DefaultLoaders())
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		if format := mediaFormat(mediaType); format != "" {
+			for _, l := range loaders {
+				if l.Parser != nil && strings.EqualFold(l.Format, format) {
+					return l.Parser
+				}
+			}
+		}
+	}
+	if u, err := url.Parse(p.url); err == nil {
+		ext := path.Ext(u.Path)
+		for _, l := range loaders {
+			if ext != "" && l.Format != "" && l.Parser != nil && l.Match("config"+ext) {
+				return l.Parser
+			}
+		}
+	}
+	return sniffer{}
+}
+
+// mediaFormat returns the configuration format named by a media type,
+// such as yaml for application/x-yaml, if it names one
+func mediaFormat(mediaType string) string {
+	_, subtype, _ := strings.Cut(mediaType, "/")
+	if _, suffix, found := strings.Cut(subtype, "+"); found {
+		subtype = suffix
+	}
+	switch strings.TrimPrefix(subtype, "x-") {
+	case "json":
+		return "json"
+	case "yaml", "yml":
+		return "yaml"
+	case "toml":
+		return "toml"
+	case "hcl":
+		return "hcl"
+	case "java-properties", "properties":
+		return "properties"
+	}
+	return ""
+}
+
+// cachePath returns the name of the file in which the source is cached
+func (p *httpProvider) cachePath() string {
+	sum := sha256.Sum256([]byte(p.url))
+	return filepath.Join(p.settings.CacheDir, hex.EncodeToString(sum[:])+".json")
+}
+
+// readCache returns the cached copy of the source, if there is one
+func (p *httpProvider) readCache() *cachedSource {
+	if p.settings.CacheDir == "" {
+		return nil
+	}
+	b, err := os.ReadFile(p.cachePath())
+	if err != nil {
+		return nil
+	}
+	var cached cachedSource
+	if err = json.Unmarshal(b, &cached); err != nil || cached.URL != p.url {
+		return nil
+	}
+	return &cached
+}
+
+// writeCache replaces the cached copy of the source. As the cache is only
+// an optimisation, failures are logged rather than returned
+func (p *httpProvider) writeCache(fetched *cachedSource) {
+	if p.settings.CacheDir == "" {
+		return
+	}
+	err := func() error {
+		if err := os.MkdirAll(p.settings.CacheDir, 0o700); err != nil {
+			return err
+		}
+		b, err := json.Marshal(fetched)
+		if err != nil {
+			return err
+		}
+		tmp, err := os.CreateTemp(p.settings.CacheDir, ".cache-*")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(tmp.Name())
+		if _, err = tmp.Write(b); err != nil {
+			tmp.Close()
+			return err
+		}
+		if err = tmp.Close(); err != nil {
+			return err
+		}
+		return os.Rename(tmp.Name(), p.cachePath())
+	}()
+	if err != nil {
+		logger.Warn("Error caching a configuration source", "url", p.redacted(), "error", err.Error())
+	}
+}
+
+// redacted returns the URL of the source with any password hidden
+func (p *httpProvider) redacted() string {
+	u, err := url.Parse(p.url)
+	if err != nil {
+		return p.url
+	}
+	return u.Redacted()
+}
+
+// Error describes the unsuccessful response
+func (e *statusError) Error() string {
+	return fmt.Sprintf("%s: %s", e.url, e.status)
+}
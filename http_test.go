@@ -0,0 +1,262 @@
+// Copyright © 2024 Bruce Smith <bruceesmith@gmail.com>
+// Use of this source code is governed by the MIT
+// License that can be found in the LICENSE file.
+
+package echidna
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHTTPLoader(t *testing.T) {
+	tests := []struct {
+		name        string
+		path        string
+		contentType string
+		body        string
+	}{
+		{
+			name:        "content type",
+			path:        "/config",
+			contentType: "application/json; charset=utf-8",
+			body:        `{"i": 33}`,
+		},
+		{
+			name:        "content type suffix",
+			path:        "/config",
+			contentType: "application/vnd.app+json",
+			body:        `{"i": 33}`,
+		},
+		{
+			name:        "extension",
+			path:        "/app.toml",
+			contentType: "text/plain",
+			body:        "i = 33\n",
+		},
+		{
+			name: "sniffed",
+			path: "/config",
+			body: "i: 33\n",
+		},
+	}
+	t.Setenv("HTTP_TEST_TOKEN", "s3cret")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if got := r.Header.Get("Authorization"); got != "Bearer s3cret" {
+					http.Error(w, "unauthorized "+got, http.StatusUnauthorized)
+					return
+				}
+				w.Header().Set("Content-Type", tt.contentType)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+			configloaders = append([]Loader{HTTPLoader(HTTPSettings{
+				Headers: map[string]string{"Authorization": "Bearer ${HTTP_TEST_TOKEN}"},
+			})}, DefaultLoaders()...)
+			defer func() { configloaders = nil }()
+			ls, err := loaders([]string{server.URL + tt.path})
+			if err != nil {
+				t.Fatal(err)
+			}
+			cfg := config{}
+			if err = configure(&cfg, ls); err != nil {
+				t.Fatalf("configure() error = %v", err)
+			}
+			if cfg.I != 33 {
+				t.Errorf("HTTPLoader() loaded I = %v, want 33", cfg.I)
+			}
+		})
+	}
+}
+
+func TestHTTPLoader_cache(t *testing.T) {
+	var (
+		requests    atomic.Int32
+		revalidated atomic.Int32
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			revalidated.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Content-Type", "application/yaml")
+		w.Write([]byte("i: 33\n"))
+	}))
+	source := server.URL + "/app"
+	settings := HTTPSettings{CacheDir: t.TempDir(), Backoff: time.Millisecond}
+	read := func(s HTTPSettings) (int, error) {
+		mp, err := HTTPLoader(s).Provider(source).Read()
+		if err != nil {
+			return 0, err
+		}
+		i, _ := mp["i"].(int)
+		return i, nil
+	}
+
+	for range 2 {
+		if i, err := read(settings); err != nil || i != 33 {
+			t.Fatalf("Read() = %v, %v, want 33", i, err)
+		}
+	}
+	if requests.Load() != 2 || revalidated.Load() != 1 {
+		t.Errorf("Read() made %v requests with %v revalidated, want 2 and 1", requests.Load(), revalidated.Load())
+	}
+
+	server.Close()
+	settings.Retries = 1
+	if i, err := read(settings); err != nil || i != 33 {
+		t.Errorf("Read() with the server unreachable = %v, %v, want the cached 33", i, err)
+	}
+	settings.CacheDir = t.TempDir()
+	if _, err := read(settings); err == nil {
+		t.Errorf("Read() with the server unreachable and no cache did not fail")
+	}
+}
+
+func TestHTTPLoader_retries(t *testing.T) {
+	tests := []struct {
+		name         string
+		failures     int32
+		status       int
+		retries      int
+		wantRequests int32
+		wantErr      string
+	}{
+		{
+			name:         "recovered",
+			failures:     2,
+			status:       http.StatusServiceUnavailable,
+			retries:      2,
+			wantRequests: 3,
+		},
+		{
+			name:         "exhausted",
+			failures:     5,
+			status:       http.StatusTooManyRequests,
+			retries:      2,
+			wantRequests: 3,
+			wantErr:      "429 Too Many Requests",
+		},
+		{
+			name:         "not retried",
+			failures:     5,
+			status:       http.StatusNotFound,
+			retries:      2,
+			wantRequests: 1,
+			wantErr:      "404 Not Found",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if requests.Add(1) <= tt.failures {
+					w.WriteHeader(tt.status)
+					return
+				}
+				w.Write([]byte(`{"i": 33}`))
+			}))
+			defer server.Close()
+			loader := HTTPLoader(HTTPSettings{Retries: tt.retries, Backoff: time.Millisecond})
+			_, err := loader.Provider(server.URL + "/app.json").Read()
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("Read() error = %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("Read() error = %v, want %v", err, tt.wantErr)
+			}
+			if got := requests.Load(); got != tt.wantRequests {
+				t.Errorf("Read() made %v requests, want %v", got, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestHTTPLoader_maxSize(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"i": 33}`))
+	}))
+	defer server.Close()
+	for _, tt := range []struct {
+		maxSize int64
+		wantErr bool
+	}{
+		{maxSize: 9},
+		{maxSize: 8, wantErr: true},
+	} {
+		loader := HTTPLoader(HTTPSettings{MaxSize: tt.maxSize})
+		if _, err := loader.Provider(server.URL + "/app.json").Read(); (err != nil) != tt.wantErr {
+			t.Errorf("Read() with MaxSize %v error = %v, wantErr %v", tt.maxSize, err, tt.wantErr)
+		}
+	}
+}
+
+func TestHTTPLoader_timeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+	loader := HTTPLoader(HTTPSettings{Timeout: 20 * time.Millisecond})
+	if _, err := loader.Provider(server.URL + "/app.json").Read(); err == nil {
+		t.Errorf("Read() of a slow server did not time out")
+	}
+}
+
+func TestHTTPLoader_includes(t *testing.T) {
+	files := map[string]string{
+		"/base/app.yaml":    "include: shared.json\nextends: yaml:/defaults\n",
+		"/base/shared.json": `{"i": 33}`,
+		"/defaults":         "i: 1\n",
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+	configloaders = DefaultLoaders()
+	defer func() {
+		configloaders = nil
+		resetOrigins()
+	}()
+	// URLs are only fetched by an HTTPLoader
+	ls, err := loaders([]string{server.URL + "/base/app.yaml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = configure(&config{}, ls); err == nil {
+		t.Errorf("configure() of a URL without an HTTPLoader did not fail")
+	}
+	configloaders = append([]Loader{HTTPLoader(HTTPSettings{})}, DefaultLoaders()...)
+	ls, err = loaders([]string{server.URL + "/base/app.yaml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := config{}
+	if err = configure(&cfg, ls); err != nil {
+		t.Fatalf("configure() error = %v", err)
+	}
+	if cfg.I != 33 {
+		t.Errorf("configure() loaded I = %v, want 33", cfg.I)
+	}
+	if origin, _ := OriginOf("i"); origin.Source != server.URL+"/base/shared.json" {
+		t.Errorf("OriginOf(i) = %v, want the included URL", origin)
+	}
+}
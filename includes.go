@@ -0,0 +1,165 @@
+// Copyright © 2024 Bruce Smith <bruceesmith@gmail.com>
+// Use of this source code is governed by the MIT
+// License that can be found in the LICENSE file.
+
+package echidna
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/bruceesmith/logger"
+	"github.com/knadh/koanf/providers/confmap"
+	"github.com/knadh/koanf/v2"
+)
+
+const (
+	// extendsKey is the top-level configuration key naming the files
+	// which a configuration file is layered on top of
+	extendsKey = "extends"
+	// includeKey is the top-level configuration key naming the files
+	// which are layered on top of a configuration file
+	includeKey = "include"
+)
+
+var (
+	// sourceFiles holds every file read by the latest load of the
+	// configuration, including those named by extends and include
+	sourceFiles []string
+)
+
+// loadSource loads a single configuration source into k. If the source is a
+// file, then any files named by its "extends" key are loaded first, followed
+// by the file itself, and then any files named by its "include" key. Both
+// keys hold either a single file or a list of files, and relative names are
+// resolved against the directory (or URL) of the file which names them.
+// Each file is parsed by the Loader which matches it, exactly as for --config.
+//
+// chain holds the files currently being loaded, and is used to detect cycles
+func loadSource(k *koanf.Koanf, source configLoader, chain []string) error {
+	mp, b, err := readSource(source)
+	if err != nil {
+		return err
+	}
+	if source.Path == "" {
+		return k.Load(confmap.Provider(mp, ""), nil, source.Options...)
+	}
+	id := source.Path
+	if id != "-" && !strings.Contains(id, "://") {
+		if abs, err := filepath.Abs(id); err == nil {
+			id = abs
+		}
+	}
+	if slices.Contains(chain, id) {
+		return fmt.Errorf("configuration include cycle: %s", strings.Join(append(chain, id), " -> "))
+	}
+	chain = append(slices.Clone(chain), id)
+	if id != "-" && !strings.Contains(id, "://") && !slices.Contains(sourceFiles, id) {
+		sourceFiles = append(sourceFiles, id)
+	}
+	extends, err := references(mp, extendsKey)
+	if err != nil {
+		return fmt.Errorf("%s: %w", source.Path, err)
+	}
+	includes, err := references(mp, includeKey)
+	if err != nil {
+		return fmt.Errorf("%s: %w", source.Path, err)
+	}
+	for _, ref := range extends {
+		err = loadReference(k, ref, source.Path, chain)
+		if err != nil {
+			return err
+		}
+	}
+	recordFileOrigins(mp, source, b)
+	err = k.Load(confmap.Provider(mp, ""), nil, source.Options...)
+	if err != nil {
+		return err
+	}
+	for _, ref := range includes {
+		err = loadReference(k, ref, source.Path, chain)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadReference loads a file named by the extends or include key of
+// another configuration file
+func loadReference(k *koanf.Koanf, ref, from string, chain []string) error {
+	format, path := splitFormat(ref)
+	switch {
+	case isURL(from) && !strings.Contains(path, "://"):
+		// A reference within a fetched source is resolved against its URL
+		base, err := url.Parse(from)
+		if err != nil {
+			return fmt.Errorf("%s: %w", from, err)
+		}
+		rel, err := url.Parse(path)
+		if err != nil {
+			return fmt.Errorf("%s (included by %s)", err.Error(), from)
+		}
+		path = base.ResolveReference(rel).String()
+	case !filepath.IsAbs(path) && !strings.Contains(path, "://"):
+		dir := "."
+		if from != "-" {
+			dir = filepath.Dir(from)
+		}
+		path = filepath.Join(dir, path)
+	}
+	if format != "" {
+		path = format + ":" + path
+	}
+	logger.Debug("including configuration file", "path", path, "included_by", from)
+	ls, err := loaders([]string{path})
+	if err != nil {
+		return fmt.Errorf("%s (included by %s)", err.Error(), from)
+	}
+	return loadSource(k, ls[0], chain)
+}
+
+// readSource reads and parses a configuration source, in the same way
+// as koanf.Load. The unparsed content is also returned, if there is any
+func readSource(source configLoader) (map[string]any, []byte, error) {
+	if source.Parser == nil {
+		mp, err := source.Provider.Read()
+		return mp, nil, err
+	}
+	b, err := source.Provider.ReadBytes()
+	if err != nil {
+		return nil, nil, err
+	}
+	mp, err := source.Parser.Unmarshal(b)
+	return mp, b, err
+}
+
+// references removes a top-level key naming other configuration
+// files from mp, and returns the files that it named
+func references(mp map[string]any, key string) ([]string, error) {
+	v, ok := mp[key]
+	if !ok {
+		return nil, nil
+	}
+	delete(mp, key)
+	switch refs := v.(type) {
+	case string:
+		return []string{refs}, nil
+	case []string:
+		return refs, nil
+	case []any:
+		result := make([]string, len(refs))
+		for i, r := range refs {
+			s, ok := r.(string)
+			if !ok {
+				return nil, fmt.Errorf("%q must list file names, but contains %v", key, r)
+			}
+			result[i] = s
+		}
+		return result, nil
+	}
+	return nil, fmt.Errorf("%q must be a file name or a list of file names, not %v", key, v)
+}
@@ -0,0 +1,136 @@
+// Copyright © 2024 Bruce Smith <bruceesmith@gmail.com>
+// Use of this source code is governed by the MIT
+// License that can be found in the LICENSE file.
+
+package echidna
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/knadh/koanf/v2"
+)
+
+func Test_readConfig_includes(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		source  string
+		want    map[string]any
+		wantErr string
+	}{
+		{
+			name: "extends",
+			files: map[string]string{
+				"base.yml": "a: base\nb: base\n",
+				"prod.yml": "extends: base.yml\nb: prod\n",
+			},
+			source: "prod.yml",
+			want:   map[string]any{"a": "base", "b": "prod"},
+		},
+		{
+			name: "include",
+			files: map[string]string{
+				"app.yml":              "include: [common.json, secrets/secrets.toml]\na: app\nb: app\n",
+				"common.json":          `{"b": "common", "c": "common"}`,
+				"secrets/secrets.toml": "d = \"secret\"\n",
+			},
+			source: "app.yml",
+			want:   map[string]any{"a": "app", "b": "common", "c": "common", "d": "secret"},
+		},
+		{
+			name: "nested-relative",
+			files: map[string]string{
+				"app.yml":       "include: env/prod.yml\n",
+				"env/prod.yml":  "extends: ../base/base.yml\nb: prod\n",
+				"base/base.yml": "a: base\nb: base\n",
+			},
+			source: "app.yml",
+			want:   map[string]any{"a": "base", "b": "prod"},
+		},
+		{
+			name: "format-override",
+			files: map[string]string{
+				"app.yml": "include: json:extra\n",
+				"extra":   `{"a": "extra"}`,
+			},
+			source: "app.yml",
+			want:   map[string]any{"a": "extra"},
+		},
+		{
+			name: "cycle",
+			files: map[string]string{
+				"a.yml": "include: b.yml\n",
+				"b.yml": "extends: a.yml\n",
+			},
+			source:  "a.yml",
+			wantErr: "a.yml -> ",
+		},
+		{
+			name: "self",
+			files: map[string]string{
+				"a.yml": "include: a.yml\n",
+			},
+			source:  "a.yml",
+			wantErr: "include cycle",
+		},
+		{
+			name: "missing",
+			files: map[string]string{
+				"a.yml": "include: b.yml\n",
+			},
+			source:  "a.yml",
+			wantErr: "b.yml",
+		},
+		{
+			name: "no-loader",
+			files: map[string]string{
+				"a.yml": "include: b.ini\n",
+			},
+			source:  "a.yml",
+			wantErr: "included by",
+		},
+		{
+			name: "bad-reference",
+			files: map[string]string{
+				"a.yml": "include: {x: 1}\n",
+			},
+			source:  "a.yml",
+			wantErr: `"include" must be`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range tt.files {
+				path := filepath.Join(dir, name)
+				if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			configloaders = DefaultLoaders()[:6]
+			sources, err := loaders([]string{filepath.Join(dir, tt.source)})
+			if err != nil {
+				t.Fatalf("loaders() error = %v", err)
+			}
+			k := koanf.New(".")
+			err = readConfig(k, sources...)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("readConfig() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Errorf("readConfig() error = %v", err)
+			} else if got := k.All(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readConfig() = %v, want %v", got, tt.want)
+			}
+			configloaders = nil
+		})
+	}
+}
@@ -0,0 +1,384 @@
+// Copyright © 2024 Bruce Smith <bruceesmith@gmail.com>
+// Use of this source code is governed by the MIT
+// License that can be found in the LICENSE file.
+
+package echidna
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/knadh/koanf/parsers/dotenv"
+	kjson "github.com/knadh/koanf/parsers/json"
+	"github.com/knadh/koanf/parsers/toml"
+	"github.com/knadh/koanf/parsers/yaml"
+	"github.com/knadh/koanf/v2"
+	gotoml "github.com/pelletier/go-toml"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// textEdit replaces the bytes from start to end of a file with text
+type textEdit struct {
+	start, end int
+	text       string
+}
+
+// fileLine is a line of a file, without its line ending
+type fileLine struct {
+	offset int // Where the line begins in the file
+	text   string
+}
+
+var (
+	// errNotEditable is returned for a format whose values cannot be edited in place
+	errNotEditable = errors.New("values in this format cannot be edited in place")
+	// errNotLocated is returned for a value which cannot be found in the file
+	errNotLocated = errors.New("the value is not set directly in the file")
+)
+
+// stringEdit returns the edit which sets the value of a key within the
+// content of a configuration file to the string s, leaving the rest of the
+// file, including its comments, untouched. The key must already be set to
+// a single value. JSON, YAML, TOML, .properties and .env files can be edited
+func stringEdit(parser koanf.Parser, b []byte, key, s string) (textEdit, error) {
+	var (
+		start, end int
+		err        error
+		text       = strconv.Quote(s)
+	)
+	switch parser.(type) {
+	case *yaml.YAML:
+		start, end, err = yamlSpan(b, key)
+	case *kjson.JSON:
+		start, end, err = jsonSpan(b, key)
+	case *toml.TOML:
+		start, end, err = tomlSpan(b, key)
+	case properties:
+		start, end, err = propertySpan(b, key)
+		text = escapeProperty(s, false)
+	case *dotenv.DotEnv:
+		start, end, err = dotenvSpan(b, key)
+	default:
+		return textEdit{}, errNotEditable
+	}
+	if err != nil {
+		return textEdit{}, fmt.Errorf("%s cannot be edited in place: %w", key, err)
+	}
+	return textEdit{start: start, end: end, text: text}, nil
+}
+
+// applyEdits returns a copy of b with the edits made
+func applyEdits(b []byte, edits []textEdit) ([]byte, error) {
+	slices.SortFunc(edits, func(x, y textEdit) int { return x.start - y.start })
+	var (
+		out  bytes.Buffer
+		next int
+	)
+	for _, e := range edits {
+		if e.start < next {
+			return nil, errors.New("overlapping edits")
+		}
+		out.Write(b[next:e.start])
+		out.WriteString(e.text)
+		next = e.end
+	}
+	out.Write(b[next:])
+	return out.Bytes(), nil
+}
+
+// yamlSpan returns the offsets of the scalar value of a key in a YAML document
+func yamlSpan(b []byte, key string) (int, int, error) {
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(b, &doc); err != nil {
+		return 0, 0, err
+	}
+	if len(doc.Content) == 0 {
+		return 0, 0, errNotLocated
+	}
+	node := doc.Content[0]
+	for _, segment := range strings.Split(key, ".") {
+		var value *yamlv3.Node
+		if node.Kind == yamlv3.MappingNode {
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if node.Content[i].Value == segment {
+					value = node.Content[i+1]
+				}
+			}
+		}
+		if value == nil {
+			return 0, 0, errNotLocated
+		}
+		node = value
+	}
+	if node.Kind != yamlv3.ScalarNode {
+		return 0, 0, errNotLocated
+	}
+	start := lineOffset(b, node.Line, node.Column)
+	if start < 0 {
+		return 0, 0, errNotLocated
+	}
+	end := -1
+	switch node.Style {
+	case yamlv3.DoubleQuotedStyle:
+		end = quotedEnd(b, start, '"', '\\')
+	case yamlv3.SingleQuotedStyle:
+		end = quotedEnd(b, start, '\'', '\'')
+	case 0:
+		if !strings.Contains(node.Value, "\n") && bytes.HasPrefix(b[start:], []byte(node.Value)) {
+			end = start + len(node.Value)
+		}
+	}
+	if end < 0 {
+		return 0, 0, errors.New("only single-line values without tags can be edited")
+	}
+	return start, end, nil
+}
+
+// jsonSpan returns the offsets of the scalar value of a key in a JSON document
+func jsonSpan(b []byte, key string) (int, int, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	start, end := -1, -1
+	if err := jsonValue(dec, b, strings.Split(key, "."), true, &start, &end); err != nil {
+		return 0, 0, err
+	}
+	if start < 0 {
+		return 0, 0, errNotLocated
+	}
+	return start, end, nil
+}
+
+// jsonValue reads the next value from dec. If want is true, path is the
+// remainder of the key being sought within the value, and when it is empty
+// the offsets of the value are recorded. As in encoding/json, the last of
+// several identical keys is the one used
+func jsonValue(dec *json.Decoder, b []byte, path []string, want bool, start, end *int) error {
+	before := int(dec.InputOffset())
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	switch tok {
+	case json.Delim('{'):
+		for dec.More() {
+			name, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			sought := want && len(path) > 0 && name == path[0]
+			var rest []string
+			if sought {
+				rest = path[1:]
+			}
+			if err = jsonValue(dec, b, rest, sought, start, end); err != nil {
+				return err
+			}
+		}
+		_, err = dec.Token()
+		return err
+	case json.Delim('['):
+		for dec.More() {
+			if err = jsonValue(dec, b, nil, false, start, end); err != nil {
+				return err
+			}
+		}
+		_, err = dec.Token()
+		return err
+	}
+	if want && len(path) == 0 {
+		// The offset before the token includes any separator which precedes it
+		for before < len(b) && strings.IndexByte(" \t\r\n:,", b[before]) >= 0 {
+			before++
+		}
+		*start, *end = before, int(dec.InputOffset())
+	}
+	return nil
+}
+
+// tomlSpan returns the offsets of the value of a key in a TOML document
+func tomlSpan(b []byte, key string) (int, int, error) {
+	tree, err := gotoml.LoadBytes(b)
+	if err != nil {
+		return 0, 0, err
+	}
+	pos := tree.GetPositionPath(strings.Split(key, "."))
+	if pos.Invalid() {
+		return 0, 0, errNotLocated
+	}
+	// The value follows the first = which is not within a quoted key
+	i := lineOffset(b, pos.Line, pos.Col)
+	for i >= 0 && i < len(b) && b[i] != '=' && b[i] != '\n' {
+		switch b[i] {
+		case '"':
+			i = quotedEnd(b, i, '"', '\\')
+		case '\'':
+			i = quotedEnd(b, i, '\'', 0)
+		default:
+			i++
+		}
+	}
+	if i < 0 || i >= len(b) || b[i] != '=' {
+		return 0, 0, errNotLocated
+	}
+	start := skipBlanks(b, i+1)
+	end := -1
+	switch {
+	case bytes.HasPrefix(b[start:], []byte(`"""`)), bytes.HasPrefix(b[start:], []byte(`'''`)):
+	case bytes.HasPrefix(b[start:], []byte(`"`)):
+		end = quotedEnd(b, start, '"', '\\')
+	case bytes.HasPrefix(b[start:], []byte(`'`)):
+		end = quotedEnd(b, start, '\'', 0)
+	default:
+		end = start
+		for end < len(b) && strings.IndexByte("#,]}\r\n", b[end]) < 0 {
+			end++
+		}
+		end = start + len(bytes.TrimRight(b[start:end], " \t"))
+	}
+	if end <= start {
+		return 0, 0, errors.New("only single-line values can be edited")
+	}
+	return start, end, nil
+}
+
+// propertySpan returns the offsets of the value of a key in a .properties
+// file. A key which is set more than once takes its last value
+func propertySpan(b []byte, key string) (int, int, error) {
+	start, end := -1, -1
+	continued := false
+	for _, l := range fileLines(b) {
+		offset, line := l.offset, l.text
+		previous := continued
+		trailing := len(line) - len(strings.TrimRight(line, `\`))
+		continued = trailing%2 == 1
+		trimmed := strings.TrimLeft(line, " \t\f")
+		if previous || trimmed == "" || trimmed[0] == '#' || trimmed[0] == '!' {
+			continue
+		}
+		if name, _, err := splitProperty(trimmed); err != nil || name != key {
+			continue
+		}
+		if continued {
+			return 0, 0, errors.New("only single-line values can be edited")
+		}
+		// The key ends at the first separator which is not escaped
+		i := len(line) - len(trimmed)
+		for ; i < len(line) && strings.IndexByte("=: \t\f", line[i]) < 0; i++ {
+			if line[i] == '\\' {
+				i++
+			}
+		}
+		i = skipBlanks([]byte(line), i)
+		if i < len(line) && (line[i] == '=' || line[i] == ':') {
+			i = skipBlanks([]byte(line), i+1)
+		}
+		start, end = offset+i, offset+len(line)
+	}
+	if start < 0 {
+		return 0, 0, errNotLocated
+	}
+	return start, end, nil
+}
+
+// dotenvSpan returns the offsets of the value of a key in a .env file.
+// A key which is set more than once takes its last value
+func dotenvSpan(b []byte, key string) (int, int, error) {
+	start, end := -1, -1
+	for _, l := range fileLines(b) {
+		offset, line := l.offset, l.text
+		trimmed := strings.TrimPrefix(strings.TrimLeft(line, " \t"), "export ")
+		sep := strings.IndexAny(trimmed, "=:")
+		if sep < 0 || strings.HasPrefix(trimmed, "#") || strings.TrimSpace(trimmed[:sep]) != key {
+			continue
+		}
+		start = skipBlanks(b, offset+len(line)-len(trimmed)+sep+1)
+		switch {
+		case bytes.HasPrefix(b[start:], []byte(`"`)):
+			end = quotedEnd(b, start, '"', '\\')
+		case bytes.HasPrefix(b[start:], []byte(`'`)):
+			end = quotedEnd(b, start, '\'', 0)
+		default:
+			value := line[start-offset:]
+			if comment := strings.Index(value, " #"); comment >= 0 {
+				value = value[:comment]
+			}
+			end = start + len(strings.TrimRight(value, " \t"))
+		}
+		if end < 0 {
+			return 0, 0, errors.New("the value has no closing quote")
+		}
+	}
+	if start < 0 {
+		return 0, 0, errNotLocated
+	}
+	return start, end, nil
+}
+
+// fileLines returns the lines of a file, in order
+func fileLines(b []byte) []fileLine {
+	var (
+		lines  []fileLine
+		offset int
+	)
+	for line := range strings.SplitAfterSeq(string(b), "\n") {
+		lines = append(lines, fileLine{offset: offset, text: strings.TrimRight(line, "\r\n")})
+		offset += len(line)
+	}
+	return lines
+}
+
+// lineOffset converts a 1-based line and column, counted in characters,
+// into an offset within b. It is -1 if there is no such position
+func lineOffset(b []byte, line, column int) int {
+	offset := 0
+	for range line - 1 {
+		i := bytes.IndexByte(b[offset:], '\n')
+		if i < 0 {
+			return -1
+		}
+		offset += i + 1
+	}
+	for range column - 1 {
+		if offset >= len(b) || b[offset] == '\n' {
+			return -1
+		}
+		_, size := utf8.DecodeRune(b[offset:])
+		offset += size
+	}
+	return offset
+}
+
+// quotedEnd returns the offset just after the quoted string which begins
+// at start, or -1 if it does not end. Within the string, escape causes the
+// next character to be skipped or, if it is the quote itself, a doubled
+// quote stands for one quote. An escape of zero means that there are none
+func quotedEnd(b []byte, start int, quote, escape byte) int {
+	if start < 0 || start >= len(b) || b[start] != quote {
+		return -1
+	}
+	for i := start + 1; i < len(b); i++ {
+		switch {
+		case escape == quote && b[i] == quote && i+1 < len(b) && b[i+1] == quote:
+			i++
+		case b[i] == quote:
+			return i + 1
+		case escape != 0 && b[i] == escape:
+			i++
+		}
+	}
+	return -1
+}
+
+// skipBlanks returns the offset of the first character at or after i
+// which is not a space, tab or form feed
+func skipBlanks(b []byte, i int) int {
+	for i < len(b) && (b[i] == ' ' || b[i] == '\t' || b[i] == '\f') {
+		i++
+	}
+	return i
+}
@@ -0,0 +1,141 @@
+// Copyright © 2024 Bruce Smith <bruceesmith@gmail.com>
+// Use of this source code is governed by the MIT
+// License that can be found in the LICENSE file.
+
+package echidna
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/knadh/koanf/parsers/dotenv"
+	"github.com/knadh/koanf/parsers/hcl"
+	kjson "github.com/knadh/koanf/parsers/json"
+	"github.com/knadh/koanf/parsers/toml"
+	"github.com/knadh/koanf/parsers/yaml"
+	"github.com/knadh/koanf/v2"
+)
+
+func Test_stringEdit(t *testing.T) {
+	tests := []struct {
+		name    string
+		parser  koanf.Parser
+		content string
+		key     string
+		want    string
+		wantErr error
+	}{
+		{
+			name:    "yaml plain",
+			parser:  yaml.Parser(),
+			content: "# db\ndb:\n  password: hunter2 # secret\n  port: 5432\n",
+			key:     "db.password",
+			want:    "# db\ndb:\n  password: \"new\" # secret\n  port: 5432\n",
+		},
+		{
+			name:    "yaml quoted",
+			parser:  yaml.Parser(),
+			content: "db: {password: 'it''s', port: 5432}\nname: \"é \\\"x\\\"\"\n",
+			key:     "db.password",
+			want:    "db: {password: \"new\", port: 5432}\nname: \"é \\\"x\\\"\"\n",
+		},
+		{
+			name:    "yaml after unicode",
+			parser:  yaml.Parser(),
+			content: "é: {a: 1, b: \"x\"}\n",
+			key:     "é.b",
+			want:    "é: {a: 1, b: \"new\"}\n",
+		},
+		{
+			name:    "yaml block",
+			parser:  yaml.Parser(),
+			content: "password: |\n  hunter2\n",
+			key:     "password",
+			wantErr: errors.New(""),
+		},
+		{
+			name:    "json",
+			parser:  kjson.Parser(),
+			content: "{\n  \"db\": {\"port\": 5432, \"password\" :  \"hun\\\"ter\"},\n  \"list\": [{\"password\": 1}]\n}\n",
+			key:     "db.password",
+			want:    "{\n  \"db\": {\"port\": 5432, \"password\" :  \"new\"},\n  \"list\": [{\"password\": 1}]\n}\n",
+		},
+		{
+			name:    "json number",
+			parser:  kjson.Parser(),
+			content: `{"port":5432,"pin":1234}`,
+			key:     "pin",
+			want:    `{"port":5432,"pin":"new"}`,
+		},
+		{
+			name:    "toml",
+			parser:  toml.Parser(),
+			content: "# app\nname = 'x'\n\n[db]\n  \"pass=word\" = \"hunter2\" # secret\n  port = 5432\n",
+			key:     "db.pass=word",
+			want:    "# app\nname = 'x'\n\n[db]\n  \"pass=word\" = \"new\" # secret\n  port = 5432\n",
+		},
+		{
+			name:    "toml number",
+			parser:  toml.Parser(),
+			content: "[db]\npin = 1234 # secret\n",
+			key:     "db.pin",
+			want:    "[db]\npin = \"new\" # secret\n",
+		},
+		{
+			name:    "properties",
+			parser:  properties{},
+			content: "# db\ndb.password = hunter2\ndb.host:localhost\\\n  .example\ndb.password\\ x=1\n",
+			key:     "db.password",
+			want:    "# db\ndb.password = new\ndb.host:localhost\\\n  .example\ndb.password\\ x=1\n",
+		},
+		{
+			name:    "properties continued",
+			parser:  properties{},
+			content: "password = hun\\\n  ter2\n",
+			key:     "password",
+			wantErr: errors.New(""),
+		},
+		{
+			name:    "dotenv",
+			parser:  dotenv.Parser(),
+			content: "# app\nexport PASSWORD=hunter2 # secret\nHOST='localhost'\n",
+			key:     "PASSWORD",
+			want:    "# app\nexport PASSWORD=\"new\" # secret\nHOST='localhost'\n",
+		},
+		{
+			name:    "missing",
+			parser:  yaml.Parser(),
+			content: "a: 1\n",
+			key:     "b",
+			wantErr: errNotLocated,
+		},
+		{
+			name:    "hcl",
+			parser:  hcl.Parser(true),
+			content: "password = \"hunter2\"\n",
+			key:     "password",
+			wantErr: errNotEditable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			edit, err := stringEdit(tt.parser, []byte(tt.content), tt.key, "new")
+			if (err != nil) != (tt.wantErr != nil) {
+				t.Fatalf("stringEdit() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if tt.wantErr.Error() != "" && !errors.Is(err, tt.wantErr) {
+					t.Errorf("stringEdit() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			got, err := applyEdits([]byte(tt.content), []textEdit{edit})
+			if err != nil {
+				t.Fatalf("applyEdits() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("stringEdit() wrote %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,214 @@
+// Copyright © 2024 Bruce Smith <bruceesmith@gmail.com>
+// Use of this source code is governed by the MIT
+// License that can be found in the LICENSE file.
+
+package echidna
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/knadh/koanf/providers/confmap"
+	"github.com/knadh/koanf/v2"
+)
+
+var (
+	// interpolation is true if Interpolate() was used
+	interpolation bool
+)
+
+// Interpolate is an Option which expands expressions in the string values of the
+// configuration, once every source has been merged and before the values are
+// stored in the configuration struct. The expressions are:
+//
+//	${NAME}           the value of environment variable NAME, which must be set
+//	${NAME:-default}  the value of NAME, or default if NAME is unset or empty
+//	${file:/path}     the content of a file, less any trailing newline
+//	${ref:other.key}  the value of another configuration key
+//
+// A default can itself contain expressions, and $${ is written as a literal ${.
+// A value which consists of a single ${ref:...} takes on the type of the
+// referenced value, so that numbers, lists and maps can be shared
+func Interpolate() Option {
+	return func() error {
+		interpolation = true
+		return nil
+	}
+}
+
+// interpolator expands the expressions in a configuration, remembering the
+// keys already expanded and those being expanded so that cycles are detected
+type interpolator struct {
+	k         *koanf.Koanf
+	done      map[string]any
+	expanding []string
+}
+
+// interpolate returns a copy of a configuration with all expressions expanded
+func interpolate(k *koanf.Koanf) (*koanf.Koanf, error) {
+	in := &interpolator{
+		k:    k,
+		done: make(map[string]any),
+	}
+	raw := k.Raw()
+	keys := make([]string, 0, len(raw))
+	for key := range raw {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	expanded := make(map[string]any, len(raw))
+	for _, key := range keys {
+		v, err := in.key(key)
+		if err != nil {
+			return nil, err
+		}
+		expanded[key] = v
+	}
+	result := koanf.New(".")
+	err := result.Load(confmap.Provider(expanded, ""), nil)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// key returns the expanded value of a configuration key
+func (in *interpolator) key(key string) (any, error) {
+	if v, ok := in.done[key]; ok {
+		return v, nil
+	}
+	if slices.Contains(in.expanding, key) {
+		return nil, fmt.Errorf("interpolation cycle: %s -> %s", strings.Join(in.expanding, " -> "), key)
+	}
+	if !in.k.Exists(key) {
+		return nil, fmt.Errorf("%s: reference to undefined key %s", in.current(), key)
+	}
+	in.expanding = append(in.expanding, key)
+	v, err := in.value(key, in.k.Get(key))
+	in.expanding = in.expanding[:len(in.expanding)-1]
+	if err != nil {
+		return nil, err
+	}
+	in.done[key] = v
+	return v, nil
+}
+
+// current returns the key currently being expanded
+func (in *interpolator) current() string {
+	if len(in.expanding) == 0 {
+		return "configuration"
+	}
+	return in.expanding[len(in.expanding)-1]
+}
+
+// value expands every string within a configuration value
+func (in *interpolator) value(key string, v any) (any, error) {
+	switch t := v.(type) {
+	case string:
+		return in.expand(key, t)
+	case []any:
+		result := make([]any, len(t))
+		for i, e := range t {
+			ev, err := in.value(fmt.Sprintf("%s[%d]", key, i), e)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = ev
+		}
+		return result, nil
+	case map[string]any:
+		result := make(map[string]any, len(t))
+		for name := range t {
+			ev, err := in.key(key + "." + name)
+			if err != nil {
+				return nil, err
+			}
+			result[name] = ev
+		}
+		return result, nil
+	}
+	return v, nil
+}
+
+// expand replaces the expressions in a string
+func (in *interpolator) expand(key, s string) (any, error) {
+	var (
+		b    strings.Builder
+		rest = s
+	)
+	for {
+		i := strings.Index(rest, "${")
+		if i < 0 {
+			b.WriteString(rest)
+			break
+		}
+		if i > 0 && rest[i-1] == '$' {
+			b.WriteString(rest[:i-1] + "${")
+			rest = rest[i+2:]
+			continue
+		}
+		end := closingBrace(rest, i+2)
+		if end < 0 {
+			return nil, fmt.Errorf("%s: unterminated expression in %q", key, s)
+		}
+		v, err := in.evaluate(key, rest[i+2:end])
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 && end == len(rest)-1 && b.Len() == 0 {
+			return v, nil
+		}
+		b.WriteString(rest[:i])
+		b.WriteString(fmt.Sprint(v))
+		rest = rest[end+1:]
+	}
+	return b.String(), nil
+}
+
+// evaluate returns the value of a single expression
+func (in *interpolator) evaluate(key, expr string) (any, error) {
+	switch {
+	case strings.HasPrefix(expr, "file:"):
+		b, err := os.ReadFile(strings.TrimPrefix(expr, "file:"))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		return strings.TrimRight(string(b), "\r\n"), nil
+	case strings.HasPrefix(expr, "ref:"):
+		return in.key(strings.TrimPrefix(expr, "ref:"))
+	}
+	name, def, hasDefault := strings.Cut(expr, ":-")
+	value, set := os.LookupEnv(name)
+	switch {
+	case set && (value != "" || !hasDefault):
+		return value, nil
+	case hasDefault:
+		v, err := in.expand(key, def)
+		if err != nil {
+			return nil, err
+		}
+		return fmt.Sprint(v), nil
+	}
+	return nil, fmt.Errorf("%s: environment variable %s is not set", key, name)
+}
+
+// closingBrace returns the index of the brace closing an expression
+// which starts at from, allowing for nested expressions
+func closingBrace(s string, from int) int {
+	depth := 1
+	for i := from; i < len(s); i++ {
+		switch s[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
@@ -0,0 +1,143 @@
+// Copyright © 2024 Bruce Smith <bruceesmith@gmail.com>
+// Use of this source code is governed by the MIT
+// License that can be found in the LICENSE file.
+
+package echidna
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/knadh/koanf/providers/confmap"
+	"github.com/knadh/koanf/v2"
+)
+
+func Test_interpolate(t *testing.T) {
+	secret := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(secret, []byte("s3cr3t\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("ECHIDNA_HOST", "db.example.com")
+	t.Setenv("ECHIDNA_EMPTY", "")
+	tests := []struct {
+		name    string
+		values  map[string]any
+		want    map[string]any
+		wantErr string
+	}{
+		{
+			name:   "env",
+			values: map[string]any{"url": "postgres://${ECHIDNA_HOST}:5432"},
+			want:   map[string]any{"url": "postgres://db.example.com:5432"},
+		},
+		{
+			name: "default",
+			values: map[string]any{
+				"a": "${ECHIDNA_UNSET:-fallback}",
+				"b": "${ECHIDNA_EMPTY:-fallback}",
+				"c": "${ECHIDNA_UNSET:-${ECHIDNA_HOST}}",
+				"d": "${ECHIDNA_EMPTY}",
+			},
+			want: map[string]any{"a": "fallback", "b": "fallback", "c": "db.example.com", "d": ""},
+		},
+		{
+			name:   "file",
+			values: map[string]any{"password": "${file:" + secret + "}"},
+			want:   map[string]any{"password": "s3cr3t"},
+		},
+		{
+			name: "ref",
+			values: map[string]any{
+				"db":      map[string]any{"host": "${ECHIDNA_HOST}", "port": 5432},
+				"url":     "${ref:db.host}:${ref:db.port}",
+				"port":    "${ref:db.port}",
+				"servers": []any{"${ref:db.host}", 1},
+			},
+			want: map[string]any{
+				"db":      map[string]any{"host": "db.example.com", "port": 5432},
+				"url":     "db.example.com:5432",
+				"port":    5432,
+				"servers": []any{"db.example.com", 1},
+			},
+		},
+		{
+			name:   "escape",
+			values: map[string]any{"template": "$${HOME} and ${ECHIDNA_HOST}"},
+			want:   map[string]any{"template": "${HOME} and db.example.com"},
+		},
+		{
+			name:    "missing-env",
+			values:  map[string]any{"a": "${ECHIDNA_UNSET}"},
+			wantErr: "a: environment variable ECHIDNA_UNSET is not set",
+		},
+		{
+			name:    "missing-ref",
+			values:  map[string]any{"a": "${ref:b}"},
+			wantErr: "a: reference to undefined key b",
+		},
+		{
+			name:    "missing-file",
+			values:  map[string]any{"a": "${file:/no/such/file}"},
+			wantErr: "a: ",
+		},
+		{
+			name:    "cycle",
+			values:  map[string]any{"a": "${ref:b}", "b": "x${ref:c}", "c": "${ref:a}"},
+			wantErr: "interpolation cycle: a -> b -> c -> a",
+		},
+		{
+			name:    "unterminated",
+			values:  map[string]any{"a": "${ECHIDNA_HOST"},
+			wantErr: "unterminated",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := koanf.New(".")
+			if err := k.Load(confmap.Provider(tt.values, ""), nil); err != nil {
+				t.Fatal(err)
+			}
+			got, err := interpolate(k)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("interpolate() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("interpolate() error = %v", err)
+			}
+			if !reflect.DeepEqual(got.Raw(), tt.want) {
+				t.Errorf("interpolate() = %v, want %v", got.Raw(), tt.want)
+			}
+		})
+	}
+}
+
+func Test_configure_interpolate(t *testing.T) {
+	t.Setenv("ECHIDNA_I", "33")
+	path := filepath.Join(t.TempDir(), "app.yml")
+	if err := os.WriteFile(path, []byte("i: ${ECHIDNA_I}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := Interpolate()(); err != nil {
+		t.Fatalf("Interpolate() error = %v", err)
+	}
+	configloaders = DefaultLoaders()
+	sources, err := loaders([]string{path})
+	if err != nil {
+		t.Fatalf("loaders() error = %v", err)
+	}
+	var cfg config
+	if err = configure(&cfg, sources); err != nil {
+		t.Errorf("configure() error = %v", err)
+	}
+	if cfg.I != 33 {
+		t.Errorf("configure() I = %v, want 33", cfg.I)
+	}
+	configloaders = nil
+	interpolation = false
+}
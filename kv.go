@@ -0,0 +1,257 @@
+// Copyright © 2024 Bruce Smith <bruceesmith@gmail.com>
+// Use of this source code is governed by the MIT
+// License that can be found in the LICENSE file.
+
+package echidna
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/knadh/koanf/v2"
+)
+
+// KVSource is a key-value store, such as etcd or Consul, holding configuration
+// values under hierarchical keys separated by "/"
+type KVSource interface {
+	// List returns the keys which begin with prefix
+	List(prefix string) ([]string, error)
+	// Get returns the value of a key, or an error wrapping ErrKeyNotFound
+	// if there is no such key
+	Get(key string) ([]byte, error)
+	// Watch arranges for changed to be called whenever a key which begins
+	// with prefix is added, changed or removed, until stop is called
+	Watch(prefix string, changed func()) (stop func(), err error)
+}
+
+// MemoryKV is a [KVSource] held in memory, intended for tests
+type MemoryKV struct {
+	mu       sync.Mutex
+	values   map[string][]byte
+	watchers map[int]kvWatcher
+	next     int
+}
+
+// kvWatcher is a function registered by MemoryKV.Watch
+type kvWatcher struct {
+	prefix  string
+	changed func()
+}
+
+// kvProvider is a koanf.Provider which reads the keys of a KVSource
+// beneath a prefix
+type kvProvider struct {
+	source KVSource
+	path   string // As named by --config, e.g. etcd://app/prod
+	prefix string
+}
+
+var (
+	// ErrKeyNotFound is returned by a KVSource for a key which does not exist
+	ErrKeyNotFound = errors.New("key not found")
+)
+
+// KVLoader returns a [Loader] for configuration held in a [KVSource]. It
+// accepts sources of the form scheme://prefix, such as etcd://app/prod, and
+// reads every key beneath the prefix into the configuration. The remainder
+// of each key after the prefix becomes the configuration key, each "/"
+// denoting a nested level, so app/prod/database/host sets database.host.
+// Values are strings, converted to the type of their field when the
+// configuration is loaded.
+//
+// Because the first Loader which matches a source is used, a KVLoader must
+// be placed ahead of the [DefaultLoaders]:
+//
+//	loaders := append([]echidna.Loader{echidna.KVLoader("etcd", store)}, echidna.DefaultLoaders()...)
+//
+// With [WatchConfig], the configuration is reloaded when the source reports
+// a change beneath the prefix
+func KVLoader(scheme string, source KVSource) Loader {
+	return Loader{
+		Provider: func(path string) koanf.Provider {
+			_, prefix, _ := strings.Cut(path, "://")
+			return &kvProvider{source: source, path: path, prefix: prefix}
+		},
+		Match: func(path string) bool {
+			name, _, found := strings.Cut(path, "://")
+			return found && strings.EqualFold(name, scheme)
+		},
+	}
+}
+
+// Read reads the keys beneath the prefix into a nested map
+func (p *kvProvider) Read() (map[string]any, error) {
+	prefix := p.listPrefix()
+	keys, err := p.source.List(prefix)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", p.path, err)
+	}
+	slices.Sort(keys)
+	result := make(map[string]any)
+	leaves := make(map[string]string) // The key which set each leaf
+	for _, key := range keys {
+		rest, ok := strings.CutPrefix(key, prefix)
+		name := kvName(rest)
+		if !ok || name == "" {
+			continue
+		}
+		value, err := p.source.Get(key)
+		if errors.Is(err, ErrKeyNotFound) {
+			// The key was removed after it was listed
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", p.path, key, err)
+		}
+		if err = setKV(result, name, string(value), key, leaves); err != nil {
+			return nil, fmt.Errorf("%s: %w", p.path, err)
+		}
+	}
+	return result, nil
+}
+
+// setKV sets a value in a nested map at a path separated by "/". It is an
+// error for the value of one key to be needed as a map by another, as when
+// both app/db and app/db/host are set
+func setKV(m map[string]any, name, value, key string, leaves map[string]string) error {
+	segments := strings.Split(name, "/")
+	for i, segment := range segments[:len(segments)-1] {
+		switch next := m[segment].(type) {
+		case nil:
+			nested := make(map[string]any)
+			m[segment] = nested
+			m = nested
+		case map[string]any:
+			m = next
+		default:
+			return fmt.Errorf("keys %s and %s conflict, as one is within the other", leaves[strings.Join(segments[:i+1], "/")], key)
+		}
+	}
+	last := segments[len(segments)-1]
+	if _, ok := m[last].(map[string]any); ok {
+		for _, within := range slices.Sorted(maps.Keys(leaves)) {
+			if strings.HasPrefix(within, name+"/") {
+				return fmt.Errorf("keys %s and %s conflict, as one is within the other", key, leaves[within])
+			}
+		}
+	}
+	m[last] = value
+	leaves[name] = key
+	return nil
+}
+
+// ReadBytes is not supported by the key-value provider
+func (p *kvProvider) ReadBytes() ([]byte, error) {
+	return nil, errors.New("key-value provider does not support this method")
+}
+
+// watch calls changed whenever a key beneath the prefix changes
+func (p *kvProvider) watch(changed func()) (func(), error) {
+	return p.source.Watch(p.listPrefix(), changed)
+}
+
+// listPrefix returns the prefix as a complete path segment, so that
+// app/prod does not also match app/production
+func (p *kvProvider) listPrefix() string {
+	if p.prefix == "" || strings.HasSuffix(p.prefix, "/") {
+		return p.prefix
+	}
+	return p.prefix + "/"
+}
+
+// kvName converts the remainder of a key after the prefix into a
+// configuration key path, separated by "/", ignoring empty segments
+func kvName(rest string) string {
+	segments := strings.FieldsFunc(rest, func(r rune) bool { return r == '/' })
+	return strings.Join(segments, "/")
+}
+
+// NewMemoryKV returns a MemoryKV holding a copy of values
+func NewMemoryKV(values map[string]string) *MemoryKV {
+	m := &MemoryKV{
+		values:   make(map[string][]byte, len(values)),
+		watchers: make(map[int]kvWatcher),
+	}
+	for k, v := range values {
+		m.values[k] = []byte(v)
+	}
+	return m
+}
+
+// List returns the keys which begin with prefix, in order
+func (m *MemoryKV) List(prefix string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var keys []string
+	for k := range m.values {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys)
+	return keys, nil
+}
+
+// Get returns the value of a key
+func (m *MemoryKV) Get(key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	value, ok := m.values[key]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", key, ErrKeyNotFound)
+	}
+	return slices.Clone(value), nil
+}
+
+// Watch calls changed after each Put or Delete of a key which
+// begins with prefix, until stop is called
+func (m *MemoryKV) Watch(prefix string, changed func()) (func(), error) {
+	if changed == nil {
+		return nil, errors.New("Watch requires a non-nil function")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	id := m.next
+	m.next++
+	m.watchers[id] = kvWatcher{prefix: prefix, changed: changed}
+	return func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		delete(m.watchers, id)
+	}, nil
+}
+
+// Put sets the value of a key
+func (m *MemoryKV) Put(key, value string) {
+	m.mu.Lock()
+	m.values[key] = []byte(value)
+	m.mu.Unlock()
+	m.notify(key)
+}
+
+// Delete removes a key
+func (m *MemoryKV) Delete(key string) {
+	m.mu.Lock()
+	delete(m.values, key)
+	m.mu.Unlock()
+	m.notify(key)
+}
+
+// notify calls the watchers of a changed key
+func (m *MemoryKV) notify(key string) {
+	m.mu.Lock()
+	var changed []func()
+	for _, w := range m.watchers {
+		if strings.HasPrefix(key, w.prefix) {
+			changed = append(changed, w.changed)
+		}
+	}
+	m.mu.Unlock()
+	for _, c := range changed {
+		c()
+	}
+}
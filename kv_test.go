@@ -0,0 +1,179 @@
+// Copyright © 2024 Bruce Smith <bruceesmith@gmail.com>
+// Use of this source code is governed by the MIT
+// License that can be found in the LICENSE file.
+
+package echidna
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestKVLoader(t *testing.T) {
+	store := NewMemoryKV(map[string]string{
+		"app/prod/name":           "prod",
+		"app/prod/database/host":  "db",
+		"app/prod/database//port": "5432",
+		"app/prod/":               "ignored",
+		"app/production/name":     "other",
+		"/app/staging/name":       "staging",
+	})
+	tests := []struct {
+		name    string
+		source  string
+		matched bool
+		want    map[string]any
+	}{
+		{
+			name:    "nested",
+			source:  "kv://app/prod",
+			matched: true,
+			want: map[string]any{
+				"name":     "prod",
+				"database": map[string]any{"host": "db", "port": "5432"},
+			},
+		},
+		{
+			name:    "trailing slash",
+			source:  "KV://app/prod/database/",
+			matched: true,
+			want:    map[string]any{"host": "db", "port": "5432"},
+		},
+		{
+			name:    "leading slash",
+			source:  "kv:///app/staging",
+			matched: true,
+			want:    map[string]any{"name": "staging"},
+		},
+		{
+			name:    "empty",
+			source:  "kv://app/missing",
+			matched: true,
+			want:    map[string]any{},
+		},
+		{
+			name:   "other scheme",
+			source: "etcd://app/prod",
+		},
+		{
+			name:   "file",
+			source: "app/prod.yaml",
+		},
+	}
+	loader := KVLoader("kv", store)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := loader.Match(tt.source); got != tt.matched {
+				t.Fatalf("Match() = %v, want %v", got, tt.matched)
+			}
+			if !tt.matched {
+				return
+			}
+			got, err := loader.Provider(tt.source).Read()
+			if err != nil {
+				t.Fatalf("Read() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Read() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKVLoader_conflict(t *testing.T) {
+	store := NewMemoryKV(map[string]string{
+		"app/prod/db":      "postgres",
+		"app/prod/db/host": "db",
+		"app/prod/name":    "prod",
+	})
+	for range 5 {
+		_, err := KVLoader("kv", store).Provider("kv://app/prod").Read()
+		if err == nil || !strings.Contains(err.Error(), "app/prod/db and app/prod/db/host conflict") {
+			t.Fatalf("Read() error = %v, want a conflict between app/prod/db and app/prod/db/host", err)
+		}
+	}
+}
+
+func TestMemoryKV_Watch(t *testing.T) {
+	store := NewMemoryKV(nil)
+	var calls int
+	stop, err := store.Watch("app/", func() { calls++ })
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Put("app/name", "x")
+	store.Put("other/name", "y")
+	store.Delete("app/name")
+	stop()
+	store.Put("app/name", "z")
+	if calls != 2 {
+		t.Errorf("Watch() called the function %v times, want 2", calls)
+	}
+	if _, err = store.Get("other/missing"); err == nil {
+		t.Errorf("Get() of a missing key did not fail")
+	}
+}
+
+func Test_WatchConfig_kv(t *testing.T) {
+	store := NewMemoryKV(map[string]string{
+		"app/name": "first",
+		"app/port": "80",
+	})
+	var cfg reloadConfig
+	cmd := reloadCommand(t, &cfg)
+	configloaders = append([]Loader{KVLoader("kv", store)}, DefaultLoaders()...)
+	events := make(chan ReloadEvent, 10)
+	delay := reloadDelay
+	reloadDelay = 10 * time.Millisecond
+	defer func() {
+		stopWatching()
+		reloadDelay = delay
+		configuration = nil
+		pristine = nil
+		configloaders = nil
+		reloadListeners = nil
+		reloadState = nil
+		watchFiles = false
+		runArgs = nil
+		publish(nil)
+		resetOrigins()
+	}()
+	if err := WatchConfig()(); err != nil {
+		t.Fatal(err)
+	}
+	if err := OnReload(func(e ReloadEvent) { events <- e })(); err != nil {
+		t.Fatal(err)
+	}
+	runArgs = []string{"test", "--config", "kv://app"}
+	if err := cmd.Run(context.Background(), runArgs); err != nil {
+		t.Fatalf("before() error = %v", err)
+	}
+	if cfg != (reloadConfig{Name: "first", Port: 80}) {
+		t.Fatalf("before() loaded %+v", cfg)
+	}
+
+	store.Put("app/port", "8080")
+	select {
+	case e := <-events:
+		updated, _ := e.New.(*reloadConfig)
+		if updated == nil || *updated != (reloadConfig{Name: "first", Port: 8080}) {
+			t.Errorf("ReloadEvent.New = %+v", e.New)
+		}
+		if e.Trigger != "kv://app" || !e.Changed("port") {
+			t.Errorf("ReloadEvent = %+v", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the configuration was not reloaded")
+	}
+
+	stopWatching()
+	store.Put("app/port", "9090")
+	select {
+	case e := <-events:
+		t.Errorf("the configuration was reloaded after watching stopped: %+v", e.New)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,399 @@
+// Copyright © 2024 Bruce Smith <bruceesmith@gmail.com>
+// Use of this source code is governed by the MIT
+// License that can be found in the LICENSE file.
+
+package echidna
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/knadh/koanf/maps"
+	"github.com/knadh/koanf/parsers/dotenv"
+	"github.com/knadh/koanf/parsers/hcl"
+	kjson "github.com/knadh/koanf/parsers/json"
+	"github.com/knadh/koanf/parsers/toml"
+	"github.com/knadh/koanf/parsers/yaml"
+	"github.com/knadh/koanf/providers/file"
+	"github.com/knadh/koanf/v2"
+)
+
+// properties implements a koanf.Parser for Java-style .properties files.
+// Keys containing dots are expanded into nested maps
+type properties struct{}
+
+// sniffer is a koanf.Parser which determines whether its input is JSON,
+// YAML or TOML from the content, and then parses it accordingly
+type sniffer struct{}
+
+// stdinProvider is a koanf.Provider which reads from standard input
+type stdinProvider struct {
+	r io.Reader
+}
+
+var (
+	// stdin is the source of a configuration named as "-"
+	stdin io.Reader = os.Stdin
+
+	// Patterns used to recognise the first significant line of a TOML or YAML document
+	tomlTable    = regexp.MustCompile(`^\[\[?\s*[\w.\-"' ]+\s*\]\]?\s*(#.*)?$`)
+	tomlKeyValue = regexp.MustCompile(`^[\w.\-"']+\s*=`)
+	yamlKeyValue = regexp.MustCompile(`^[\w.\-"' ]+:(\s|$)`)
+)
+
+// DefaultLoaders returns a [Loader] for each of the common configuration
+// file formats: JSON (.json), YAML (.yaml, .yml), TOML (.toml), HCL (.hcl),
+// dotenv (.env) and Java properties (.properties). File extensions are
+// matched without regard to case. The final Loader is a [SniffLoader],
+// so a source with any other extension, or none at all, has its format
+// determined from its content.
+//
+// The Loaders can be combined with custom Loaders. Because the first Loader
+// whose Match function accepts a path is used, custom Loaders placed ahead
+// of the defaults take precedence:
+//
+//	loaders := append(myLoaders, echidna.DefaultLoaders()...)
+//
+// Sources named by a URL are not fetched unless an [HTTPLoader] is added
+func DefaultLoaders() []Loader {
+	return []Loader{
+		{
+			Format:   "json",
+			Provider: fileProvider,
+			Parser:   kjson.Parser(),
+			Match:    MatchExtension(".json"),
+		},
+		{
+			Format:   "yaml",
+			Provider: fileProvider,
+			Parser:   yaml.Parser(),
+			Match:    MatchExtension(".yaml", ".yml"),
+		},
+		{
+			Format:   "toml",
+			Provider: fileProvider,
+			Parser:   toml.Parser(),
+			Match:    MatchExtension(".toml"),
+		},
+		{
+			Format:   "hcl",
+			Provider: fileProvider,
+			Parser:   hcl.Parser(true),
+			Match:    MatchExtension(".hcl"),
+		},
+		{
+			Format:   "env",
+			Provider: fileProvider,
+			Parser:   dotenv.Parser(),
+			Match:    MatchExtension(".env"),
+		},
+		{
+			Format:   "properties",
+			Provider: fileProvider,
+			Parser:   properties{},
+			Match:    MatchExtension(".properties"),
+		},
+		SniffLoader(),
+	}
+}
+
+// MatchExtension returns a function suitable for the Match field of a
+// [Loader]. The function reports whether a path ends with one of the
+// given file extensions, ignoring case. An HTTP(S) URL is never matched,
+// as it is left for an [HTTPLoader]
+func MatchExtension(extensions ...string) func(string) bool {
+	return func(path string) bool {
+		if isURL(path) {
+			return false
+		}
+		ext := filepath.Ext(path)
+		return slices.ContainsFunc(extensions, func(e string) bool {
+			return strings.EqualFold(e, ext)
+		})
+	}
+}
+
+// SniffLoader returns a [Loader] which accepts any source, and determines
+// whether it is JSON, YAML or TOML by examining its content. It is intended
+// to be the last of the Loaders passed to [Configuration], catching sources
+// whose extension is missing or not recognised by any other Loader
+func SniffLoader() Loader {
+	return Loader{
+		Provider: fileProvider,
+		Parser:   sniffer{},
+		Match: func(_ string) bool {
+			return true
+		},
+	}
+}
+
+// fileProvider returns a koanf.Provider which reads from a file
+func fileProvider(path string) koanf.Provider {
+	return file.Provider(path)
+}
+
+// formatLoader returns a configuration loader for a source whose format was
+// given explicitly. Loaders provided to Configuration() are preferred over
+// the built-in Loaders
+func formatLoader(format, source string) (configLoader, bool) {
+	for _, l := range slices.Concat(configloaders, DefaultLoaders()) {
+		if l.Format == "" || !strings.EqualFold(l.Format, format) {
+			continue
+		}
+		var provider koanf.Provider
+		switch {
+		case source == "-":
+			provider = stdinProvider{r: stdin}
+		case isURL(source):
+			provider = urlProvider(source)
+		default:
+			provider = l.Provider(source)
+		}
+		return configLoader{
+			Provider: provider,
+			Parser:   l.Parser,
+			Options:  slices.Concat([]koanf.Option{}, mergeOptions(), l.Options),
+		}, true
+	}
+	return configLoader{}, false
+}
+
+// urlProvider returns the provider of the first Loader which matches
+// an HTTP(S) URL, so that a URL can be given with an explicit format
+func urlProvider(source string) koanf.Provider {
+	for _, l := range slices.Concat(configloaders, DefaultLoaders()) {
+		if l.Match(source) {
+			return l.Provider(source)
+		}
+	}
+	return nil
+}
+
+// sniff determines the format of a configuration from its content
+func sniff(b []byte) (koanf.Parser, error) {
+	content := bytes.TrimSpace(bytes.TrimPrefix(b, []byte("\xef\xbb\xbf")))
+	switch {
+	case len(content) == 0:
+		// An empty document is treated as YAML, which yields an empty map
+		return yaml.Parser(), nil
+	case content[0] == '{':
+		return kjson.Parser(), nil
+	}
+	var first string
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			first = line
+			break
+		}
+	}
+	switch {
+	case tomlTable.MatchString(first), tomlKeyValue.MatchString(first):
+		return toml.Parser(), nil
+	case first == "---", strings.HasPrefix(first, "- "), yamlKeyValue.MatchString(first):
+		return yaml.Parser(), nil
+	case strings.HasPrefix(first, "["):
+		return kjson.Parser(), nil
+	}
+	return nil, errors.New("unable to determine the configuration format from its content")
+}
+
+// splitFormat separates an explicit format from a source given as format:path.
+// The prefix is only treated as a format if a Loader is known by that name
+func splitFormat(path string) (format, source string) {
+	name, rest, found := strings.Cut(path, ":")
+	if !found || name == "" {
+		return "", path
+	}
+	for _, l := range slices.Concat(configloaders, DefaultLoaders()) {
+		if l.Format != "" && strings.EqualFold(l.Format, name) {
+			return name, rest
+		}
+	}
+	return "", path
+}
+
+// Marshal converts a configuration map into .properties format
+func (p properties) Marshal(o map[string]any) ([]byte, error) {
+	flat, _ := maps.Flatten(o, nil, ".")
+	keys := make([]string, 0, len(flat))
+	for k := range flat {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var buf bytes.Buffer
+	for _, k := range keys {
+		fmt.Fprintf(&buf, "%s=%s\n", escapeProperty(k, true), escapeProperty(fmt.Sprint(flat[k]), false))
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal parses the contents of a .properties file
+func (p properties) Unmarshal(b []byte) (map[string]any, error) {
+	flat := make(map[string]any)
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	var (
+		logical string
+		number  int
+	)
+	for scanner.Scan() {
+		number++
+		line := strings.TrimLeft(scanner.Text(), " \t\f")
+		if logical == "" && (line == "" || line[0] == '#' || line[0] == '!') {
+			continue
+		}
+		// A line ending in an odd number of backslashes continues on the next line
+		trailing := len(line) - len(strings.TrimRight(line, `\`))
+		if trailing%2 == 1 {
+			logical += line[:len(line)-1]
+			continue
+		}
+		logical += line
+		key, value, err := splitProperty(logical)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", number, err)
+		}
+		flat[key] = value
+		logical = ""
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if logical != "" {
+		key, value, err := splitProperty(logical)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", number, err)
+		}
+		flat[key] = value
+	}
+	return maps.Unflatten(flat, "."), nil
+}
+
+// escapeProperty escapes the characters which are special in a .properties file
+func escapeProperty(s string, key bool) string {
+	var sb strings.Builder
+	for i, r := range s {
+		switch {
+		case r == '\\':
+			sb.WriteString(`\\`)
+		case r == '\n':
+			sb.WriteString(`\n`)
+		case r == '\r':
+			sb.WriteString(`\r`)
+		case r == '\t':
+			sb.WriteString(`\t`)
+		case r == '\f':
+			sb.WriteString(`\f`)
+		case key && (r == '=' || r == ':' || r == ' '):
+			sb.WriteRune('\\')
+			sb.WriteRune(r)
+		case !key && i == 0 && r == ' ':
+			sb.WriteString(`\ `)
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+// splitProperty separates a logical .properties line into its key and value,
+// processing any escape sequences
+func splitProperty(line string) (key, value string, err error) {
+	var (
+		sb      strings.Builder
+		escaped bool
+		inKey   = true
+	)
+	for i := 0; i < len(line); {
+		r, size := utf8.DecodeRuneInString(line[i:])
+		i += size
+		if escaped {
+			escaped = false
+			switch r {
+			case 't':
+				sb.WriteRune('\t')
+			case 'n':
+				sb.WriteRune('\n')
+			case 'r':
+				sb.WriteRune('\r')
+			case 'f':
+				sb.WriteRune('\f')
+			case 'u':
+				if i+4 > len(line) {
+					return "", "", fmt.Errorf("malformed \\u escape in %q", line)
+				}
+				code, perr := strconv.ParseUint(line[i:i+4], 16, 32)
+				if perr != nil {
+					return "", "", fmt.Errorf("malformed \\u escape in %q", line)
+				}
+				sb.WriteRune(rune(code))
+				i += 4
+			default:
+				sb.WriteRune(r)
+			}
+			continue
+		}
+		switch {
+		case r == '\\':
+			escaped = true
+		case inKey && (r == '=' || r == ':' || r == ' ' || r == '\t' || r == '\f'):
+			key = sb.String()
+			sb.Reset()
+			inKey = false
+			// Skip whitespace and at most one separator after the key
+			rest := strings.TrimLeft(line[i:], " \t\f")
+			if r != '=' && r != ':' && rest != "" && (rest[0] == '=' || rest[0] == ':') {
+				rest = rest[1:]
+			}
+			rest = strings.TrimLeft(rest, " \t\f")
+			i = len(line) - len(rest)
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	if inKey {
+		key = sb.String()
+	} else {
+		value = sb.String()
+	}
+	if key == "" {
+		return "", "", fmt.Errorf("missing key in %q", line)
+	}
+	return key, value, nil
+}
+
+// Marshal is not supported by the sniffer, as the output format is unknown
+func (s sniffer) Marshal(_ map[string]any) ([]byte, error) {
+	return nil, errors.New("the sniffing parser does not support marshalling")
+}
+
+// Unmarshal determines the format of the configuration and parses it
+func (s sniffer) Unmarshal(b []byte) (map[string]any, error) {
+	parser, err := sniff(b)
+	if err != nil {
+		return nil, err
+	}
+	return parser.Unmarshal(b)
+}
+
+// Read is not supported by the standard input provider
+func (s stdinProvider) Read() (map[string]any, error) {
+	return nil, errors.New("stdin provider does not support this method")
+}
+
+// ReadBytes reads the whole of standard input
+func (s stdinProvider) ReadBytes() ([]byte, error) {
+	return io.ReadAll(s.r)
+}
@@ -0,0 +1,408 @@
+// Copyright © 2024 Bruce Smith <bruceesmith@gmail.com>
+// Use of this source code is governed by the MIT
+// License that can be found in the LICENSE file.
+
+package echidna
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/knadh/koanf/parsers/dotenv"
+	"github.com/knadh/koanf/parsers/hcl"
+	kjson "github.com/knadh/koanf/parsers/json"
+	"github.com/knadh/koanf/parsers/toml"
+	"github.com/knadh/koanf/parsers/yaml"
+)
+
+func TestDefaultLoaders(t *testing.T) {
+	tests := []struct {
+		name       string
+		path       string
+		wantParser any
+	}{
+		{
+			name:       "json",
+			path:       "testdata/test.json",
+			wantParser: kjson.Parser(),
+		},
+		{
+			name:       "yaml",
+			path:       "testdata/test.yml",
+			wantParser: yaml.Parser(),
+		},
+		{
+			name:       "toml",
+			path:       "testdata/test.toml",
+			wantParser: toml.Parser(),
+		},
+		{
+			name:       "hcl",
+			path:       "testdata/test.hcl",
+			wantParser: hcl.Parser(true),
+		},
+		{
+			name:       "dotenv",
+			path:       "testdata/test.env",
+			wantParser: dotenv.Parser(),
+		},
+		{
+			name:       "properties",
+			path:       "testdata/test.properties",
+			wantParser: properties{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configloaders = DefaultLoaders()
+			got, err := loaders([]string{tt.path})
+			if err != nil {
+				t.Fatalf("loaders() error = %v", err)
+			}
+			if reflect.TypeOf(got[0].Parser) != reflect.TypeOf(tt.wantParser) {
+				t.Errorf("DefaultLoaders() parser = %T, want %T", got[0].Parser, tt.wantParser)
+			}
+			cfg := config{}
+			if err = configure(&cfg, got); err != nil {
+				t.Fatalf("configure() error = %v", err)
+			}
+			if cfg.I != 33 {
+				t.Errorf("DefaultLoaders() loaded I = %v, want 33", cfg.I)
+			}
+		})
+	}
+	configloaders = nil
+}
+
+func TestMatchExtension(t *testing.T) {
+	tests := []struct {
+		name       string
+		extensions []string
+		path       string
+		want       bool
+	}{
+		{
+			name:       "match",
+			extensions: []string{".yaml", ".yml"},
+			path:       "/etc/app/config.yml",
+			want:       true,
+		},
+		{
+			name:       "upper-case",
+			extensions: []string{".yaml", ".yml"},
+			path:       "CONFIG.YAML",
+			want:       true,
+		},
+		{
+			name:       "no-match",
+			extensions: []string{".json"},
+			path:       "config.yml",
+			want:       false,
+		},
+		{
+			name:       "no-extension",
+			extensions: []string{".json"},
+			path:       "config",
+			want:       false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MatchExtension(tt.extensions...)(tt.path); got != tt.want {
+				t.Errorf("MatchExtension() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_properties_Unmarshal(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    map[string]any
+		wantErr bool
+	}{
+		{
+			name:  "separators",
+			input: "a=1\nb: 2\nc 3\n  d  =  4\n",
+			want: map[string]any{
+				"a": "1",
+				"b": "2",
+				"c": "3",
+				"d": "4",
+			},
+		},
+		{
+			name:  "comments",
+			input: "# comment\n! another\n\na=1\n",
+			want: map[string]any{
+				"a": "1",
+			},
+		},
+		{
+			name:  "nested",
+			input: "db.host=localhost\ndb.port=5432\n",
+			want: map[string]any{
+				"db": map[string]any{
+					"host": "localhost",
+					"port": "5432",
+				},
+			},
+		},
+		{
+			name:  "continuation",
+			input: "list=a,\\\n    b,\\\n    c\n",
+			want: map[string]any{
+				"list": "a,b,c",
+			},
+		},
+		{
+			name:  "escapes",
+			input: "key\\ with\\=sep=tab\\there \\u0041\n",
+			want: map[string]any{
+				"key with=sep": "tab\there A",
+			},
+		},
+		{
+			name:    "bad-unicode",
+			input:   "a=\\u00zz\n",
+			wantErr: true,
+		},
+		{
+			name:    "missing-key",
+			input:   "=value\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := properties{}.Unmarshal([]byte(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("properties.Unmarshal() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("properties.Unmarshal() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_properties_Marshal(t *testing.T) {
+	in := map[string]any{
+		"db": map[string]any{
+			"host": "localhost",
+			"port": 5432,
+		},
+		"a key": " leading space",
+	}
+	b, err := properties{}.Marshal(in)
+	if err != nil {
+		t.Fatalf("properties.Marshal() error = %v", err)
+	}
+	want := "a\\ key=\\ leading space\ndb.host=localhost\ndb.port=5432\n"
+	if string(b) != want {
+		t.Errorf("properties.Marshal() = %q, want %q", b, want)
+	}
+	round, err := properties{}.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("properties.Unmarshal() error = %v", err)
+	}
+	if round["a key"] != " leading space" {
+		t.Errorf("properties round trip = %q", round["a key"])
+	}
+}
+
+func TestSniffLoader(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{
+			name:    "json",
+			content: `{"i": 33}`,
+		},
+		{
+			name:    "yaml",
+			content: "# comment\ni: 33\n",
+		},
+		{
+			name:    "toml",
+			content: "i = 33\n",
+		},
+		{
+			name:    "unknown",
+			content: "<i>33</i>",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name)
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			configloaders = []Loader{SniffLoader()}
+			got, err := loaders([]string{path})
+			if err != nil {
+				t.Fatalf("loaders() error = %v", err)
+			}
+			cfg := config{}
+			err = configure(&cfg, got)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("configure() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && cfg.I != 33 {
+				t.Errorf("SniffLoader() loaded I = %v, want 33", cfg.I)
+			}
+		})
+	}
+	configloaders = nil
+}
+
+func Test_loaders_sources(t *testing.T) {
+	tests := []struct {
+		name         string
+		paths        []string
+		stdin        string
+		wantProvider any
+		wantParser   any
+		wantErr      bool
+	}{
+		{
+			name:         "stdin",
+			paths:        []string{"-"},
+			stdin:        "i: 33\n",
+			wantProvider: stdinProvider{},
+			wantParser:   sniffer{},
+		},
+		{
+			name:         "stdin-with-format",
+			paths:        []string{"json:-"},
+			stdin:        `{"i": 33}`,
+			wantProvider: stdinProvider{},
+			wantParser:   kjson.Parser(),
+		},
+		{
+			name:         "format-override",
+			paths:        []string{"yaml:testdata/test.json.yaml-really"},
+			wantProvider: fileProvider("x"),
+			wantParser:   yaml.Parser(),
+		},
+		{
+			name:         "format-case-insensitive",
+			paths:        []string{"TOML:testdata/test.toml"},
+			wantProvider: fileProvider("x"),
+			wantParser:   toml.Parser(),
+		},
+		{
+			name:    "stdin-twice",
+			paths:   []string{"-", "yaml:-"},
+			wantErr: true,
+		},
+		{
+			name:    "not-a-format",
+			paths:   []string{"c:/config/app"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configloaders = nil
+			stdin = strings.NewReader(tt.stdin)
+			got, err := loaders(tt.paths)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loaders() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if reflect.TypeOf(got[0].Provider) != reflect.TypeOf(tt.wantProvider) {
+				t.Errorf("loaders() provider = %T, want %T", got[0].Provider, tt.wantProvider)
+			}
+			if reflect.TypeOf(got[0].Parser) != reflect.TypeOf(tt.wantParser) {
+				t.Errorf("loaders() parser = %T, want %T", got[0].Parser, tt.wantParser)
+			}
+			if tt.stdin != "" {
+				cfg := config{}
+				if err = configure(&cfg, got); err != nil {
+					t.Fatalf("configure() error = %v", err)
+				}
+				if cfg.I != 33 {
+					t.Errorf("loaders() loaded I = %v from stdin, want 33", cfg.I)
+				}
+			}
+		})
+	}
+	stdin = os.Stdin
+}
+
+func Test_sniff(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    any
+		wantErr bool
+	}{
+		{
+			name:    "empty",
+			content: "  \n",
+			want:    yaml.Parser(),
+		},
+		{
+			name:    "json-object",
+			content: "\n  {\"a\": 1}",
+			want:    kjson.Parser(),
+		},
+		{
+			name:    "toml-table",
+			content: "# settings\n[server]\nport = 80\n",
+			want:    toml.Parser(),
+		},
+		{
+			name:    "toml-array-table",
+			content: "[[servers]]\nname = \"a\"\n",
+			want:    toml.Parser(),
+		},
+		{
+			name:    "toml-key",
+			content: "title = \"x\"\n",
+			want:    toml.Parser(),
+		},
+		{
+			name:    "yaml-document",
+			content: "---\na: 1\n",
+			want:    yaml.Parser(),
+		},
+		{
+			name:    "yaml-key",
+			content: "server:\n  port: 80\n",
+			want:    yaml.Parser(),
+		},
+		{
+			name:    "json-array",
+			content: `["a", "b"]`,
+			want:    kjson.Parser(),
+		},
+		{
+			name:    "unknown",
+			content: "just some words",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := sniff([]byte(tt.content))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("sniff() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && reflect.TypeOf(got) != reflect.TypeOf(tt.want) {
+				t.Errorf("sniff() = %T, want %T", got, tt.want)
+			}
+		})
+	}
+}
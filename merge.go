@@ -0,0 +1,182 @@
+// Copyright © 2024 Bruce Smith <bruceesmith@gmail.com>
+// Use of this source code is governed by the MIT
+// License that can be found in the LICENSE file.
+
+package echidna
+
+import (
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/knadh/koanf/v2"
+)
+
+const (
+	// mergeTag is the struct tag which sets how a field's values from
+	// successive configuration sources are combined
+	mergeTag = "merge"
+)
+
+// mergeStrategy is the parsed form of a merge tag
+type mergeStrategy struct {
+	kind string // One of "append", "bykey", "replace" or "unique"
+	key  string // For "bykey", the key identifying elements of a slice of maps
+}
+
+// mergeStrategies returns the merge strategy of every field of a configuration
+// struct which has a merge tag, indexed by the lower-cased koanf key of the field
+//
+// The merge tag can have the values:
+//   - "replace": a later source's value replaces the earlier one (the default for slices)
+//   - "append": a later source's slice is appended to the earlier one
+//   - "unique": as for append, but elements already present are not repeated
+//   - "bykey=<name>": slices of structs (maps in the configuration sources) are merged
+//     element by element, matching elements on the value of key <name>. Elements
+//     without a match are appended
+//
+// A map field tagged "replace" is replaced as a whole, rather than having
+// its keys merged
+func mergeStrategies(cfg any) (map[string]mergeStrategy, error) {
+	result := make(map[string]mergeStrategy)
+	for _, f := range configFields(reflect.ValueOf(cfg)) {
+		tag, ok := f.Field.Tag.Lookup(mergeTag)
+		if !ok {
+			continue
+		}
+		kind, key, _ := strings.Cut(tag, "=")
+		strategy := mergeStrategy{kind: kind, key: key}
+		switch {
+		case kind == "bykey" && key == "":
+			return nil, fmt.Errorf("field %s: merge:\"bykey\" requires a key, e.g. merge:\"bykey=name\"", f.Key)
+		case kind != "bykey" && key != "":
+			return nil, fmt.Errorf("field %s: merge:%q does not take a key", f.Key, tag)
+		case kind == "replace":
+			if k := f.Field.Type.Kind(); k != reflect.Slice && k != reflect.Map {
+				return nil, fmt.Errorf("field %s: merge:%q requires a slice or map", f.Key, tag)
+			}
+		case kind == "append", kind == "unique", kind == "bykey":
+			if f.Field.Type.Kind() != reflect.Slice {
+				return nil, fmt.Errorf("field %s: merge:%q requires a slice", f.Key, tag)
+			}
+		default:
+			return nil, fmt.Errorf("field %s: unknown merge strategy %q", f.Key, tag)
+		}
+		result[strings.ToLower(f.Key)] = strategy
+	}
+	return result, nil
+}
+
+// mergeOptions returns the koanf.Options which implement the merge tags
+// of the configuration struct, if it has any
+func mergeOptions() []koanf.Option {
+	if configuration == nil {
+		return nil
+	}
+	strategies, err := mergeStrategies(configuration)
+	if err != nil || len(strategies) == 0 {
+		return nil
+	}
+	return []koanf.Option{
+		koanf.WithMergeFunc(func(src, dest map[string]any) error {
+			mergeMaps(src, dest, "", strategies)
+			return nil
+		}),
+	}
+}
+
+// mergeMaps recursively merges src into dest, applying the merge
+// strategies of any fields which have them
+func mergeMaps(src, dest map[string]any, prefix string, strategies map[string]mergeStrategy) {
+	for k, sv := range src {
+		path := k
+		if prefix != "" {
+			path = prefix + "." + k
+		}
+		dv, exists := dest[k]
+		strategy, tagged := strategies[strings.ToLower(path)]
+		switch {
+		case !exists:
+			dest[k] = sv
+		case tagged:
+			dest[k] = strategy.merge(dv, sv)
+		default:
+			sm, sok := sv.(map[string]any)
+			dm, dok := dv.(map[string]any)
+			if sok && dok {
+				mergeMaps(sm, dm, path, strategies)
+			} else {
+				dest[k] = sv
+			}
+		}
+	}
+}
+
+// merge combines an earlier value (dest) with a later one (src)
+func (m mergeStrategy) merge(dest, src any) any {
+	ds, dok := toSlice(dest)
+	ss, sok := toSlice(src)
+	if m.kind == "replace" || !dok || !sok {
+		return src
+	}
+	switch m.kind {
+	case "append":
+		return slices.Concat(ds, ss)
+	case "unique":
+		result := slices.Clone(ds)
+		for _, s := range ss {
+			if !slices.ContainsFunc(result, func(r any) bool { return reflect.DeepEqual(r, s) }) {
+				result = append(result, s)
+			}
+		}
+		return result
+	case "bykey":
+		result := slices.Clone(ds)
+		for _, s := range ss {
+			sm, ok := s.(map[string]any)
+			if !ok {
+				result = append(result, s)
+				continue
+			}
+			i := slices.IndexFunc(result, func(r any) bool {
+				rm, ok := r.(map[string]any)
+				return ok && m.sameKey(rm, sm)
+			})
+			if i < 0 {
+				result = append(result, s)
+				continue
+			}
+			merged := maps.Clone(result[i].(map[string]any))
+			mergeMaps(sm, merged, "", nil)
+			result[i] = merged
+		}
+		return result
+	}
+	return src
+}
+
+// sameKey reports whether two elements of a slice being merged by key match
+func (m mergeStrategy) sameKey(a, b map[string]any) bool {
+	av, aok := a[m.key]
+	bv, bok := b[m.key]
+	return aok && bok && fmt.Sprint(av) == fmt.Sprint(bv)
+}
+
+// toSlice converts any slice to a []any, as parsers differ in the slice
+// types they produce
+func toSlice(v any) ([]any, bool) {
+	if s, ok := v.([]any); ok {
+		return s, true
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice {
+		return nil, false
+	}
+	result := make([]any, rv.Len())
+	for i := range rv.Len() {
+		result[i] = rv.Index(i).Interface()
+	}
+	return result, true
+}
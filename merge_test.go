@@ -0,0 +1,205 @@
+// Copyright © 2024 Bruce Smith <bruceesmith@gmail.com>
+// Use of this source code is governed by the MIT
+// License that can be found in the LICENSE file.
+
+package echidna
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/knadh/koanf/v2"
+)
+
+type mergeServer struct {
+	Name string `koanf:"name"`
+	Port int    `koanf:"port"`
+}
+
+type mergeConfig struct {
+	Plugins  []string          `koanf:"plugins" merge:"append"`
+	Hosts    []string          `koanf:"hosts" merge:"unique"`
+	Servers  []mergeServer     `koanf:"servers" merge:"bykey=name"`
+	Labels   map[string]string `koanf:"labels" merge:"replace"`
+	Defaults []string          `koanf:"defaults"`
+	Extra    map[string]string `koanf:"extra"`
+}
+
+func (m *mergeConfig) Validate() error { return nil }
+
+func Test_mergeStrategies(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     any
+		want    map[string]mergeStrategy
+		wantErr bool
+	}{
+		{
+			name: "ok",
+			cfg:  &mergeConfig{},
+			want: map[string]mergeStrategy{
+				"plugins": {kind: "append"},
+				"hosts":   {kind: "unique"},
+				"servers": {kind: "bykey", key: "name"},
+				"labels":  {kind: "replace"},
+			},
+		},
+		{
+			name: "none",
+			cfg:  &config{},
+			want: map[string]mergeStrategy{},
+		},
+		{
+			name: "unknown",
+			cfg: &struct {
+				A []string `merge:"prepend"`
+			}{},
+			wantErr: true,
+		},
+		{
+			name: "bykey-without-key",
+			cfg: &struct {
+				A []mergeServer `merge:"bykey"`
+			}{},
+			wantErr: true,
+		},
+		{
+			name: "key-not-allowed",
+			cfg: &struct {
+				A []string `merge:"append=x"`
+			}{},
+			wantErr: true,
+		},
+		{
+			name: "append-not-slice",
+			cfg: &struct {
+				A map[string]string `merge:"append"`
+			}{},
+			wantErr: true,
+		},
+		{
+			name: "replace-scalar",
+			cfg: &struct {
+				A int `merge:"replace"`
+			}{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := mergeStrategies(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("mergeStrategies() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mergeStrategies() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_mergeMaps(t *testing.T) {
+	strategies, _ := mergeStrategies(&mergeConfig{})
+	dest := map[string]any{
+		"plugins": []any{"a"},
+		"hosts":   []any{"x", "y"},
+		"servers": []any{
+			map[string]any{"name": "one", "port": 1},
+			map[string]any{"name": "two", "port": 2},
+		},
+		"labels":   map[string]any{"a": "1", "b": "2"},
+		"defaults": []any{"d1"},
+		"extra":    map[string]any{"a": "1"},
+	}
+	src := map[string]any{
+		"plugins": []any{"b"},
+		"hosts":   []any{"y", "z"},
+		"servers": []map[string]any{
+			{"name": "two", "port": 22},
+			{"name": "three", "port": 3},
+		},
+		"labels":   map[string]any{"c": "3"},
+		"defaults": []any{"d2"},
+		"extra":    map[string]any{"b": "2"},
+		"new":      "value",
+	}
+	want := map[string]any{
+		"plugins": []any{"a", "b"},
+		"hosts":   []any{"x", "y", "z"},
+		"servers": []any{
+			map[string]any{"name": "one", "port": 1},
+			map[string]any{"name": "two", "port": 22},
+			map[string]any{"name": "three", "port": 3},
+		},
+		"labels":   map[string]any{"c": "3"},
+		"defaults": []any{"d2"},
+		"extra":    map[string]any{"a": "1", "b": "2"},
+		"new":      "value",
+	}
+	mergeMaps(src, dest, "", strategies)
+	if !reflect.DeepEqual(dest, want) {
+		t.Errorf("mergeMaps() = %v, want %v", dest, want)
+	}
+}
+
+func Test_loaders_merge(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"base.yml": "plugins: [a]\nservers:\n  - name: one\n    port: 1\ndefaults: [d1]\n",
+		"over.yml": "plugins: [b]\nservers:\n  - name: one\n    port: 11\n  - name: two\n    port: 2\ndefaults: [d2]\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var cfg mergeConfig
+	configuration = &cfg
+	configloaders = DefaultLoaders()
+	got, err := loaders([]string{filepath.Join(dir, "base.yml"), filepath.Join(dir, "over.yml")})
+	if err != nil {
+		t.Fatalf("loaders() error = %v", err)
+	}
+	if err = configure(&cfg, got); err != nil {
+		t.Fatalf("configure() error = %v", err)
+	}
+	want := mergeConfig{
+		Plugins:  []string{"a", "b"},
+		Servers:  []mergeServer{{Name: "one", Port: 11}, {Name: "two", Port: 2}},
+		Defaults: []string{"d2"},
+	}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("configure() with merge tags = %+v, want %+v", cfg, want)
+	}
+
+	// A Loader's own Options follow those derived from merge tags, so they take precedence
+	replaced := false
+	custom := DefaultLoaders()[1]
+	custom.Options = []koanf.Option{
+		koanf.WithMergeFunc(func(src, dest map[string]any) error {
+			replaced = true
+			maps.Copy(dest, src)
+			return nil
+		}),
+	}
+	configloaders = []Loader{custom}
+	got, err = loaders([]string{filepath.Join(dir, "base.yml")})
+	if err != nil {
+		t.Fatalf("loaders() error = %v", err)
+	}
+	if len(got[0].Options) != 2 {
+		t.Errorf("loaders() Options = %d, want 2", len(got[0].Options))
+	}
+	cfg = mergeConfig{}
+	if err = configure(&cfg, got); err != nil {
+		t.Fatalf("configure() error = %v", err)
+	}
+	if !replaced {
+		t.Errorf("loaders() did not use the Loader's merge function")
+	}
+	configuration = nil
+	configloaders = nil
+}
@@ -0,0 +1,236 @@
+// Copyright © 2024 Bruce Smith <bruceesmith@gmail.com>
+// Use of this source code is governed by the MIT
+// License that can be found in the LICENSE file.
+
+package echidna
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+
+	kmaps "github.com/knadh/koanf/maps"
+	"github.com/knadh/koanf/parsers/toml"
+	"github.com/knadh/koanf/parsers/yaml"
+	gotoml "github.com/pelletier/go-toml"
+	"github.com/urfave/cli/v3"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// OriginKind identifies the kind of source which set a configuration value
+type OriginKind string
+
+const (
+	OriginDefault OriginKind = "default" // The value in the struct, or its default tag
+	OriginFile    OriginKind = "file"    // A configuration source named by --config, or included by one
+	OriginEnv     OriginKind = "env"     // An environment variable
+	OriginFlag    OriginKind = "flag"    // A command-line flag
+)
+
+// Origin records where the value of a configuration key came from
+type Origin struct {
+	Kind   OriginKind
+	Source string // The file, environment variable or flag; empty for a default
+	Line   int    // The line within a file, if the file's format provides it
+}
+
+// String describes an Origin, for example "file /etc/app/app.yml:12"
+func (o Origin) String() string {
+	switch {
+	case o.Source == "":
+		return string(o.Kind)
+	case o.Line > 0:
+		return fmt.Sprintf("%s %s:%d", o.Kind, o.Source, o.Line)
+	}
+	return fmt.Sprintf("%s %s", o.Kind, o.Source)
+}
+
+var (
+	// origins holds the origin of every configuration key that was set from
+	// a source other than the struct itself, indexed by lower-cased key
+	origins     = make(map[string]Origin)
+	originsLock sync.RWMutex
+
+	// runArgs are the arguments passed to the command by Run
+	runArgs []string
+)
+
+// Origins returns the origin of every leaf key of the configuration,
+// as at the last time it was loaded
+func Origins() map[string]Origin {
+	result := make(map[string]Origin)
+	if configuration == nil {
+		return result
+	}
+	flat, _ := kmaps.Flatten(plainValue(reflect.ValueOf(configuration), "", false, false).(map[string]any), nil, ".")
+	for key := range flat {
+		result[key], _ = OriginOf(key)
+	}
+	return result
+}
+
+// OriginOf returns the origin of the value of a configuration key. The key
+// need not be a leaf: the origin of a map or list is that of the last source
+// to set any part of it. ok is false if the key is not known at all
+func OriginOf(key string) (origin Origin, ok bool) {
+	originsLock.RLock()
+	defer originsLock.RUnlock()
+	key = strings.ToLower(key)
+	for k := key; ; {
+		if origin, ok = origins[k]; ok {
+			return origin, true
+		}
+		i := strings.LastIndexAny(k, ".[")
+		if i < 0 {
+			break
+		}
+		k = k[:i]
+	}
+	for k, o := range origins {
+		if strings.HasPrefix(k, key+".") {
+			return o, true
+		}
+	}
+	if configuration != nil {
+		for _, f := range configFields(reflect.ValueOf(configuration)) {
+			if strings.EqualFold(f.Key, key) || strings.HasPrefix(strings.ToLower(f.Key), key+".") {
+				return Origin{Kind: OriginDefault}, true
+			}
+		}
+	}
+	return Origin{}, false
+}
+
+// resetOrigins forgets the origins of the configuration values
+func resetOrigins() {
+	originsLock.Lock()
+	defer originsLock.Unlock()
+	origins = make(map[string]Origin)
+}
+
+// snapshotOrigins returns a copy of the origins of the configuration values
+func snapshotOrigins() map[string]Origin {
+	originsLock.RLock()
+	defer originsLock.RUnlock()
+	return maps.Clone(origins)
+}
+
+// restoreOrigins replaces the origins of the configuration
+// values with those saved by snapshotOrigins
+func restoreOrigins(saved map[string]Origin) {
+	originsLock.Lock()
+	defer originsLock.Unlock()
+	origins = saved
+}
+
+// recordOrigin records the origin of a configuration key
+func recordOrigin(key string, origin Origin) {
+	originsLock.Lock()
+	defer originsLock.Unlock()
+	origins[strings.ToLower(key)] = origin
+}
+
+// recordFileOrigins records a configuration file as the origin of every
+// key that it sets, with line numbers for YAML and TOML files
+func recordFileOrigins(mp map[string]any, source configLoader, b []byte) {
+	lines := sourceLines(source.Parser, b)
+	flat, _ := kmaps.Flatten(mp, nil, ".")
+	for key := range flat {
+		recordOrigin(key, Origin{Kind: OriginFile, Source: source.Path, Line: lines[key]})
+	}
+}
+
+// sourceLines returns the line on which each key is set in a configuration
+// file, if the format of the file allows it to be found
+func sourceLines(parser any, b []byte) map[string]int {
+	if _, ok := parser.(sniffer); ok {
+		parser, _ = sniff(b)
+	}
+	lines := make(map[string]int)
+	switch parser.(type) {
+	case *yaml.YAML:
+		var node yamlv3.Node
+		if yamlv3.Unmarshal(b, &node) == nil && len(node.Content) > 0 {
+			yamlLines(node.Content[0], "", lines)
+		}
+	case *toml.TOML:
+		tree, err := gotoml.LoadBytes(b)
+		if err != nil {
+			break
+		}
+		flat, _ := kmaps.Flatten(tree.ToMap(), nil, ".")
+		for key := range flat {
+			lines[key] = tree.GetPositionPath(strings.Split(key, ".")).Line
+		}
+	}
+	return lines
+}
+
+// yamlLines records the line of every key within a YAML mapping
+func yamlLines(node *yamlv3.Node, prefix string, lines map[string]int) {
+	if node.Kind != yamlv3.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key := joinKey(prefix, node.Content[i].Value)
+		lines[key] = node.Content[i].Line
+		yamlLines(node.Content[i+1], key, lines)
+	}
+}
+
+// recordFlagOrigins records the origin of every field of cfg which was
+// set by a struct-bound command-line flag or its environment variable
+func recordFlagOrigins(cmd *cli.Command, cfg Configurator, names []string, b binder) {
+	keys := make(map[uintptr]string)
+	for _, f := range configFields(reflect.ValueOf(cfg)) {
+		if f.Value.CanAddr() {
+			keys[f.Value.Addr().Pointer()] = f.Key
+		}
+	}
+	for _, name := range names {
+		field, ok := b.configFields[name]
+		if !ok || !field.CanAddr() {
+			continue
+		}
+		key, ok := keys[field.Addr().Pointer()]
+		if !ok {
+			continue
+		}
+		recordOrigin(key, flagOrigin(cmd, name))
+	}
+}
+
+// flagOrigin returns the origin of the value of a flag: the flag itself if
+// it was given on the command line, or else the environment variable bound to it
+func flagOrigin(cmd *cli.Command, name string) Origin {
+	origin := Origin{Kind: OriginFlag, Source: "--" + name}
+	var flag cli.Flag
+	for _, c := range cmd.Lineage() {
+		i := slices.IndexFunc(c.Flags, func(f cli.Flag) bool { return slices.Contains(f.Names(), name) })
+		if i >= 0 {
+			flag = c.Flags[i]
+			break
+		}
+	}
+	if flag == nil {
+		return origin
+	}
+	for _, arg := range runArgs {
+		arg, _, _ = strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if slices.Contains(flag.Names(), arg) {
+			return origin
+		}
+	}
+	if ef, ok := flag.(interface{ GetEnvVars() []string }); ok {
+		for _, env := range ef.GetEnvVars() {
+			if _, set := os.LookupEnv(env); set {
+				return Origin{Kind: OriginEnv, Source: env}
+			}
+		}
+	}
+	return origin
+}
@@ -0,0 +1,190 @@
+// Copyright © 2024 Bruce Smith <bruceesmith@gmail.com>
+// Use of this source code is governed by the MIT
+// License that can be found in the LICENSE file.
+
+package echidna
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/knadh/koanf/parsers/json"
+	"github.com/knadh/koanf/parsers/toml"
+	"github.com/knadh/koanf/parsers/yaml"
+	"github.com/urfave/cli/v3"
+)
+
+func TestOrigin_String(t *testing.T) {
+	tests := []struct {
+		name   string
+		origin Origin
+		want   string
+	}{
+		{
+			name:   "default",
+			origin: Origin{Kind: OriginDefault},
+			want:   "default",
+		},
+		{
+			name:   "file",
+			origin: Origin{Kind: OriginFile, Source: "app.json"},
+			want:   "file app.json",
+		},
+		{
+			name:   "file-line",
+			origin: Origin{Kind: OriginFile, Source: "app.yml", Line: 3},
+			want:   "file app.yml:3",
+		},
+		{
+			name:   "env",
+			origin: Origin{Kind: OriginEnv, Source: "APP_PORT"},
+			want:   "env APP_PORT",
+		},
+		{
+			name:   "flag",
+			origin: Origin{Kind: OriginFlag, Source: "--port"},
+			want:   "flag --port",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.origin.String(); got != tt.want {
+				t.Errorf("Origin.String() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_sourceLines(t *testing.T) {
+	tests := []struct {
+		name    string
+		parser  any
+		content string
+		want    map[string]int
+	}{
+		{
+			name:    "yaml",
+			parser:  yaml.Parser(),
+			content: "# comment\na: 1\nb:\n  c: 2\n\n  d: [1, 2]\n",
+			want:    map[string]int{"a": 2, "b": 3, "b.c": 4, "b.d": 6},
+		},
+		{
+			name:    "toml",
+			parser:  toml.Parser(),
+			content: "a = 1\n\n[b]\nc = 2\n",
+			want:    map[string]int{"a": 1, "b.c": 4},
+		},
+		{
+			name:    "sniffed",
+			parser:  sniffer{},
+			content: "a: 1\nb: 2\n",
+			want:    map[string]int{"a": 1, "b": 2},
+		},
+		{
+			name:    "json",
+			parser:  json.Parser(),
+			content: `{"a": 1}`,
+			want:    map[string]int{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sourceLines(tt.parser, []byte(tt.content)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sourceLines() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_before_origins(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"base.yml":  "database:\n  host: base.example.com\n  pool_size: 5\nhosts: [a]\ninclude: over.toml\n",
+		"over.toml": "[database]\npool_size = 10\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("ECHIDNA_TEST_LABELS", "env=prod")
+	t.Setenv("HOSTS", "x,y")
+	var cfg envConfigStruct
+	cmd := &cli.Command{
+		Name:   "test",
+		Before: before,
+		Action: func(context.Context, *cli.Command) error {
+			return nil
+		},
+		Flags: []cli.Flag{
+			&cli.StringSliceFlag{
+				Name: "config",
+			},
+		},
+		Writer:    &bytes.Buffer{},
+		ErrWriter: &bytes.Buffer{},
+	}
+	if err := ConfigFlags([]Configurator{&cfg}, cmd)(); err != nil {
+		t.Fatal(err)
+	}
+	configuration = &cfg
+	configloaders = DefaultLoaders()
+	if err := ConfigEnv("ECHIDNA_TEST_", "")(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		configuration = nil
+		configloaders = nil
+		envConfig = nil
+		runArgs = nil
+		resetOrigins()
+	}()
+	base := filepath.Join(dir, "base.yml")
+	runArgs = []string{"test", "--config", base, "--database-host=flag.example.com"}
+	if err := cmd.Run(context.Background(), runArgs); err != nil {
+		t.Fatalf("before() error = %v", err)
+	}
+	want := map[string]string{
+		"database.host":      "flag --database-host",
+		"database.pool_size": "file " + filepath.Join(dir, "over.toml") + ":2",
+		"hosts":              "env HOSTS",
+		"labels.env":         "env ECHIDNA_TEST_LABELS",
+		"internal":           "default",
+	}
+	got := Origins()
+	for key, origin := range want {
+		if got[key].String() != origin {
+			t.Errorf("Origins()[%s] = %v, want %v", key, got[key], origin)
+		}
+	}
+	if o, ok := OriginOf("labels"); !ok || o.Kind != OriginEnv {
+		t.Errorf("OriginOf(labels) = %v, %v", o, ok)
+	}
+	if o, ok := OriginOf("Database"); !ok || o.Kind == OriginDefault {
+		t.Errorf("OriginOf(Database) = %v, %v", o, ok)
+	}
+	if _, ok := OriginOf("nosuch"); ok {
+		t.Errorf("OriginOf(nosuch) found an origin")
+	}
+
+	// config show --origin prints each value with its origin
+	buf := &bytes.Buffer{}
+	configCommands = nil
+	_ = ConfigCommand()()
+	defer func() { configCommands = nil }()
+	cmd.Commands = []*cli.Command{configCommand()}
+	cmd.Writer = buf
+	runArgs = []string{"test", "--config", base, "--database-host=flag.example.com", "config", "show", "--origin", "database"}
+	if err := cmd.Run(context.Background(), runArgs); err != nil {
+		t.Fatalf("config show --origin error = %v", err)
+	}
+	wantShow := "database.host = flag.example.com  # flag --database-host\n" +
+		"database.pool_size = 10  # file " + filepath.Join(dir, "over.toml") + ":2\n"
+	if buf.String() != wantShow {
+		t.Errorf("config show --origin = %q, want %q", buf.String(), wantShow)
+	}
+}
@@ -0,0 +1,351 @@
+// Copyright © 2024 Bruce Smith <bruceesmith@gmail.com>
+// Use of this source code is governed by the MIT
+// License that can be found in the LICENSE file.
+
+package echidna
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// secretTag is the struct tag which marks a configuration field as sensitive
+	secretTag = "secret"
+
+	// redactedValue replaces the value of a secret wherever it is displayed
+	redactedValue = "[REDACTED]"
+
+	// minSecretLength is the length below which secret values are not
+	// searched for in text, as they would match too often
+	minSecretLength = 4
+)
+
+var (
+	// durationType is the type of time.Duration
+	durationType = reflect.TypeFor[time.Duration]()
+
+	// publishedSecrets holds the values of the secrets within the
+	// configuration returned by Current, found when it was published
+	publishedSecrets atomic.Pointer[[]string]
+)
+
+// isSecretField reports whether a struct field is tagged secret:"true"
+func isSecretField(field reflect.StructField) bool {
+	secret, _ := strconv.ParseBool(field.Tag.Get(secretTag))
+	return secret
+}
+
+// plainValue converts a configuration value into nested maps, slices and
+// scalars, using the koanf names of struct fields as map keys. key is the
+// path of the value within the configuration, and secret is true if the
+// value is itself marked as a secret. If redact is true, then every non-zero
+// secret value is replaced by [REDACTED]. A secret is a field tagged
+// secret:"true", at any depth, or a value that was resolved from a secret
+// reference or decrypted when the configuration was loaded
+func plainValue(v reflect.Value, key string, secret, redact bool) any {
+	if !v.IsValid() {
+		return nil
+	}
+	if redact && (secret || isSecret(key)) && !v.IsZero() {
+		return redactedValue
+	}
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return plainValue(v.Elem(), key, secret, redact)
+	case reflect.Struct:
+		if !isNested(v.Type()) {
+			return v.Interface()
+		}
+		result := make(map[string]any)
+		for i := range v.NumField() {
+			field := v.Type().Field(i)
+			name := keyName(field)
+			if name == "" {
+				continue
+			}
+			result[name] = plainValue(v.Field(i), joinKey(key, name), secret || isSecretField(field), redact)
+		}
+		return result
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && (v.IsNil() || v.Type().Elem().Kind() == reflect.Uint8) {
+			return v.Interface()
+		}
+		result := make([]any, v.Len())
+		for i := range v.Len() {
+			result[i] = plainValue(v.Index(i), fmt.Sprintf("%s[%d]", key, i), secret, redact)
+		}
+		return result
+	case reflect.Map:
+		if v.IsNil() {
+			return v.Interface()
+		}
+		result := make(map[string]any, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			name := fmt.Sprint(iter.Key().Interface())
+			result[name] = plainValue(iter.Value(), joinKey(key, name), secret, redact)
+		}
+		return result
+	}
+	if v.Type() == durationType {
+		return v.Interface().(time.Duration).String()
+	}
+	return v.Interface()
+}
+
+// joinKey appends a name to a configuration key path
+func joinKey(key, name string) string {
+	if key == "" {
+		return name
+	}
+	return key + "." + name
+}
+
+// redactedConfig returns the configuration as nested maps with
+// every secret value redacted
+func redactedConfig(cfg any) map[string]any {
+	m, _ := plainValue(reflect.ValueOf(cfg), "", false, true).(map[string]any)
+	return m
+}
+
+// secretValues returns the values of every secret within the configuration,
+// together with the secrets that were resolved when it was loaded. Until a
+// configuration is published, the one being loaded is searched instead
+func secretValues() []string {
+	var values []string
+	if published := publishedSecrets.Load(); published != nil {
+		values = append(values, *published...)
+	} else if configuration != nil {
+		values = configSecrets(configuration)
+	}
+	values = append(values, cachedSecrets()...)
+	values = slices.DeleteFunc(values, func(s string) bool { return len(s) < minSecretLength })
+	// Longer values are replaced first, in case one secret contains another
+	slices.SortFunc(values, func(a, b string) int { return cmp.Compare(len(b), len(a)) })
+	return slices.Compact(values)
+}
+
+// configSecrets returns the values of the secrets within a configuration
+func configSecrets(cfg Configurator) []string {
+	var values []string
+	raw := plainValue(reflect.ValueOf(cfg), "", false, false)
+	redacted := plainValue(reflect.ValueOf(cfg), "", false, true)
+	collectSecrets(raw, redacted, &values)
+	return values
+}
+
+// publishSecrets records the secrets within a newly published configuration
+func publishSecrets(cfg Configurator) {
+	if cfg == nil {
+		publishedSecrets.Store(nil)
+		return
+	}
+	values := configSecrets(cfg)
+	publishedSecrets.Store(&values)
+}
+
+// collectSecrets finds the values which were redacted in the redacted form
+// of a configuration, by comparing it with the raw form
+func collectSecrets(raw, redacted any, values *[]string) {
+	switch r := redacted.(type) {
+	case map[string]any:
+		if m, ok := raw.(map[string]any); ok {
+			for k, v := range r {
+				collectSecrets(m[k], v, values)
+			}
+		}
+	case []any:
+		if s, ok := raw.([]any); ok && len(s) == len(r) {
+			for i, v := range r {
+				collectSecrets(s[i], v, values)
+			}
+		}
+	case string:
+		if r == redactedValue {
+			leaves(raw, values)
+		}
+	}
+}
+
+// leaves appends the string form of every scalar within a value
+func leaves(v any, values *[]string) {
+	switch t := v.(type) {
+	case map[string]any:
+		for _, e := range t {
+			leaves(e, values)
+		}
+	case []any:
+		for _, e := range t {
+			leaves(e, values)
+		}
+	default:
+		*values = append(*values, fmt.Sprint(t))
+	}
+}
+
+// redactText replaces every secret value within a string
+func redactText(s string) string {
+	for _, secret := range secretValues() {
+		s = strings.ReplaceAll(s, secret, redactedValue)
+	}
+	return s
+}
+
+// redactedError is an error whose message has had secret values removed
+type redactedError struct {
+	msg string
+	err error
+}
+
+// Error returns the redacted message
+func (e redactedError) Error() string {
+	return e.msg
+}
+
+// Unwrap returns the original error
+func (e redactedError) Unwrap() error {
+	return e.err
+}
+
+// redactError returns an error whose message contains no secret values
+func redactError(err error) error {
+	if err == nil {
+		return nil
+	}
+	msg := redactText(err.Error())
+	if msg == err.Error() {
+		return err
+	}
+	return redactedError{msg: msg, err: err}
+}
+
+// hasSecrets reports whether a type contains a field tagged secret:"true"
+func hasSecrets(t reflect.Type, seen map[reflect.Type]bool) bool {
+	for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || seen[t] {
+		return false
+	}
+	seen[t] = true
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if keyName(field) != "" && (isSecretField(field) || hasSecrets(field.Type, seen)) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactingHandler is a slog.Handler which removes secret values from
+// log records before passing them to another handler
+type redactingHandler struct {
+	slog.Handler
+}
+
+// Handle redacts a log record
+func (h redactingHandler) Handle(ctx context.Context, r slog.Record) error {
+	redacted := slog.NewRecord(r.Time, r.Level, redactText(r.Message), r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		redacted.AddAttrs(redactAttr(a))
+		return true
+	})
+	return h.Handler.Handle(ctx, redacted)
+}
+
+// WithAttrs redacts attributes added to a logger
+func (h redactingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		redacted[i] = redactAttr(a)
+	}
+	return redactingHandler{h.Handler.WithAttrs(redacted)}
+}
+
+// WithGroup returns a redacting handler for a group
+func (h redactingHandler) WithGroup(name string) slog.Handler {
+	return redactingHandler{h.Handler.WithGroup(name)}
+}
+
+// redactAttr removes secret values from a log attribute. A configuration
+// struct, or any struct with secret fields, is logged in its redacted form
+func redactAttr(a slog.Attr) slog.Attr {
+	v := a.Value.Resolve()
+	switch v.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, redactText(v.String()))
+	case slog.KindGroup:
+		group := v.Group()
+		redacted := make([]any, len(group))
+		for i, g := range group {
+			redacted[i] = redactAttr(g)
+		}
+		return slog.Group(a.Key, redacted...)
+	case slog.KindAny:
+		if err, ok := v.Any().(error); ok {
+			return slog.Any(a.Key, redactError(err))
+		}
+		rv := reflect.ValueOf(v.Any())
+		isConfig := configuration != nil && rv.IsValid() && rv.Type() == reflect.TypeOf(configuration)
+		if rv.IsValid() && (isConfig || hasSecrets(rv.Type(), map[reflect.Type]bool{})) {
+			return slog.Any(a.Key, plainValue(rv, "", false, true))
+		}
+		if text := fmt.Sprintf("%+v", v.Any()); redactText(text) != text {
+			return slog.String(a.Key, redactText(text))
+		}
+	}
+	return slog.Attr{Key: a.Key, Value: v}
+}
+
+// redactingWriter is an io.Writer which removes secret values from
+// log entries before writing them to another io.Writer
+type redactingWriter struct {
+	io.Writer
+}
+
+// Write redacts a log entry, including secrets escaped by a JSON or text
+// handler. The length of the original is returned, as callers expect the
+// whole entry to have been written
+func (w redactingWriter) Write(p []byte) (int, error) {
+	entry := string(p)
+	for _, secret := range secretValues() {
+		entry = strings.ReplaceAll(entry, secret, redactedValue)
+		quoted := strconv.Quote(secret)
+		if escaped := quoted[1 : len(quoted)-1]; escaped != secret {
+			entry = strings.ReplaceAll(entry, escaped, redactedValue)
+		}
+	}
+	if _, err := w.Writer.Write([]byte(entry)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// redactLogs removes secret values from everything logged through the
+// default slog logger, until restoreLogs is called. The trace logger is
+// redacted by Run, which wraps the ErrWriter of the command
+func redactLogs() {
+	if _, ok := slog.Default().Handler().(redactingHandler); !ok {
+		slog.SetDefault(slog.New(redactingHandler{slog.Default().Handler()}))
+	}
+}
+
+// restoreLogs undoes redactLogs, once the command has finished
+func restoreLogs() {
+	if h, ok := slog.Default().Handler().(redactingHandler); ok {
+		slog.SetDefault(slog.New(h.Handler))
+	}
+}
@@ -0,0 +1,311 @@
+// Copyright © 2024 Bruce Smith <bruceesmith@gmail.com>
+// Use of this source code is governed by the MIT
+// License that can be found in the LICENSE file.
+
+package echidna
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bruceesmith/logger"
+	set "github.com/deckarep/golang-set/v2"
+	"github.com/urfave/cli/v3"
+)
+
+type redactUser struct {
+	Name     string `koanf:"name"`
+	Password string `koanf:"password" secret:"true"`
+}
+
+type redactConfig struct {
+	Host    string                `koanf:"host"`
+	Token   string                `koanf:"token" secret:"true"`
+	Empty   string                `koanf:"empty" secret:"true"`
+	Timeout time.Duration         `koanf:"timeout"`
+	Users   []redactUser          `koanf:"users"`
+	Peers   map[string]redactUser `koanf:"peers"`
+	Headers map[string]string     `koanf:"headers" secret:"true"`
+}
+
+func (redactConfig) Validate() error {
+	return nil
+}
+
+func testRedactConfig() *redactConfig {
+	return &redactConfig{
+		Host:    "localhost",
+		Token:   "tok-123456",
+		Timeout: 5 * time.Second,
+		Users:   []redactUser{{Name: "bob", Password: "bobs-password"}},
+		Peers:   map[string]redactUser{"east": {Name: "east", Password: "east-password"}},
+		Headers: map[string]string{"Authorization": "Bearer xyz"},
+	}
+}
+
+func Test_plainValue(t *testing.T) {
+	cfg := testRedactConfig()
+	tests := []struct {
+		name   string
+		redact bool
+		want   map[string]any
+	}{
+		{
+			name:   "raw",
+			redact: false,
+			want: map[string]any{
+				"host":    "localhost",
+				"token":   "tok-123456",
+				"empty":   "",
+				"timeout": "5s",
+				"users":   []any{map[string]any{"name": "bob", "password": "bobs-password"}},
+				"peers":   map[string]any{"east": map[string]any{"name": "east", "password": "east-password"}},
+				"headers": map[string]any{"Authorization": "Bearer xyz"},
+			},
+		},
+		{
+			name:   "redacted",
+			redact: true,
+			want: map[string]any{
+				"host":    "localhost",
+				"token":   redactedValue,
+				"empty":   "",
+				"timeout": "5s",
+				"users":   []any{map[string]any{"name": "bob", "password": redactedValue}},
+				"peers":   map[string]any{"east": map[string]any{"name": "east", "password": redactedValue}},
+				"headers": redactedValue,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := plainValue(reflect.ValueOf(cfg), "", false, tt.redact)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("plainValue() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// Values resolved from secret references are redacted too
+	secretKeys.Add("host")
+	defer resetSecrets()
+	if got := redactedConfig(cfg)["host"]; got != redactedValue {
+		t.Errorf("redactedConfig() host = %v, want %v", got, redactedValue)
+	}
+}
+
+func Test_hasSecrets(t *testing.T) {
+	tests := []struct {
+		name string
+		arg  any
+		want bool
+	}{
+		{
+			name: "top-level",
+			arg:  redactUser{},
+			want: true,
+		},
+		{
+			name: "nested",
+			arg:  &redactConfig{},
+			want: true,
+		},
+		{
+			name: "slice",
+			arg:  []redactUser{},
+			want: true,
+		},
+		{
+			name: "none",
+			arg:  config{},
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hasSecrets(reflect.TypeOf(tt.arg), map[reflect.Type]bool{}); got != tt.want {
+				t.Errorf("hasSecrets() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_redactError(t *testing.T) {
+	configuration = testRedactConfig()
+	publish(configuration)
+	defer func() {
+		configuration = nil
+		publish(nil)
+	}()
+	plain := errors.New("host localhost is unreachable")
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{
+			name: "nil",
+			err:  nil,
+		},
+		{
+			name: "no-secret",
+			err:  plain,
+			want: "host localhost is unreachable",
+		},
+		{
+			name: "secret",
+			err:  fmt.Errorf("token tok-123456 and password bobs-password are invalid"),
+			want: "token [REDACTED] and password [REDACTED] are invalid",
+		},
+		{
+			name: "map",
+			err:  fmt.Errorf("header Bearer xyz rejected"),
+			want: "header [REDACTED] rejected",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := redactError(tt.err)
+			if tt.err == nil {
+				if got != nil {
+					t.Errorf("redactError() = %v, want nil", got)
+				}
+				return
+			}
+			if got.Error() != tt.want {
+				t.Errorf("redactError() = %v, want %v", got, tt.want)
+			}
+			if !errors.Is(got, tt.err) {
+				t.Errorf("redactError() does not wrap the original error")
+			}
+		})
+	}
+}
+
+func Test_redactingHandler(t *testing.T) {
+	configuration = testRedactConfig()
+	publish(configuration)
+	defer func() {
+		configuration = nil
+		publish(nil)
+	}()
+	buf := &bytes.Buffer{}
+	log := slog.New(redactingHandler{slog.NewTextHandler(buf, nil)})
+	log.With("token", "tok-123456").Info(
+		"connecting with tok-123456",
+		"config", configuration,
+		"user", redactUser{Name: "alice", Password: "alices-password"},
+		"error", errors.New("bad password bobs-password"),
+		slog.Group("g", "header", "Bearer xyz"),
+		"host", "localhost",
+	)
+	got := buf.String()
+	for _, secret := range []string{"tok-123456", "bobs-password", "east-password", "alices-password", "Bearer xyz"} {
+		if strings.Contains(got, secret) {
+			t.Errorf("redactingHandler logged %q in %s", secret, got)
+		}
+	}
+	if !strings.Contains(got, "localhost") || !strings.Contains(got, "alice") {
+		t.Errorf("redactingHandler removed values which are not secret: %s", got)
+	}
+}
+
+type redactRunConfig struct {
+	Token string `koanf:"token" secret:"true" default:"tok-123456"`
+}
+
+func (*redactRunConfig) Validate() error { return nil }
+
+func Test_redactLogs(t *testing.T) {
+	inuse := flags.inuse.ToSlice()
+	def := slog.Default()
+	defer func() {
+		flags.inuse = set.NewSet(inuse...)
+		slog.SetDefault(def)
+		logger.SetLevel(slog.LevelInfo)
+		logger.RedirectTrace(os.Stderr)
+		noOsExit = false
+	}()
+	noOsExit = true
+	tests := []struct {
+		name      string
+		errWriter bool
+	}{
+		{name: "command ErrWriter", errWriter: true},
+		{name: "program destination"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			program, errWriter := &bytes.Buffer{}, &bytes.Buffer{}
+			logger.RedirectTrace(program)
+			var redacted bool
+			cmd := &cli.Command{
+				Name: "test",
+				Action: func(context.Context, *cli.Command) error {
+					_, redacted = slog.Default().Handler().(redactingHandler)
+					logger.SetLevel(logger.LevelTrace)
+					logger.Trace("connecting", "token", "tok-123456")
+					return nil
+				},
+				Writer: &bytes.Buffer{},
+			}
+			if tt.errWriter {
+				cmd.ErrWriter = errWriter
+			}
+			os.Args = []string{"test"}
+			Run(context.Background(), cmd, Configuration(&redactRunConfig{}, DefaultLoaders()))
+			if !redacted {
+				t.Errorf("Run() did not redact the default logger")
+			}
+			if _, ok := slog.Default().Handler().(redactingHandler); ok {
+				t.Errorf("Run() left the default logger redacted")
+			}
+			// Trace entries go to the ErrWriter of the command if it has
+			// one, with secrets removed, and are otherwise left alone
+			got, other := errWriter, program
+			if !tt.errWriter {
+				got, other = program, errWriter
+			}
+			if !strings.Contains(got.String(), "connecting") || other.Len() > 0 {
+				t.Errorf("trace logger wrote %q, and %q elsewhere", got, other)
+			}
+			if tt.errWriter && (strings.Contains(got.String(), "tok-123456") || !strings.Contains(got.String(), redactedValue)) {
+				t.Errorf("trace logger wrote %q", got)
+			}
+		})
+	}
+}
+
+func Test_redactingWriter(t *testing.T) {
+	buf := &bytes.Buffer{}
+	defer func() {
+		configuration = nil
+		publish(nil)
+	}()
+	w := redactingWriter{buf}
+	configuration = testRedactConfig()
+	publish(configuration)
+	fmt.Fprintln(w, `first token="tok-123456"`)
+
+	// A reload publishes a configuration with different secrets
+	rotated := testRedactConfig()
+	rotated.Token = `new"token`
+	publish(rotated)
+	fmt.Fprintln(w, `second token="new\"token"`)
+	for _, secret := range []string{"tok-123456", `new\"token`} {
+		if strings.Contains(buf.String(), secret) {
+			t.Errorf("redactingWriter wrote %q in %s", secret, buf.String())
+		}
+	}
+	if strings.Count(buf.String(), redactedValue) != 2 {
+		t.Errorf("redactingWriter wrote %s, want two redacted values", buf.String())
+	}
+}
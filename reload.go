@@ -0,0 +1,370 @@
+// Copyright © 2024 Bruce Smith <bruceesmith@gmail.com>
+// Use of this source code is governed by the MIT
+// License that can be found in the LICENSE file.
+
+package echidna
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bruceesmith/logger"
+	"github.com/fsnotify/fsnotify"
+	"github.com/urfave/cli/v3"
+)
+
+// ReloadEvent describes a successful reload of the configuration
+type ReloadEvent struct {
+	Old     Configurator // The configuration in use before the reload
+	New     Configurator // The configuration now returned by Current
+	Trigger string       // What caused the reload, such as the file that changed
+	Changes []Change     // The keys whose values changed, in key order
+}
+
+// ReloadListener is a function called each time the configuration is reloaded
+type ReloadListener func(ReloadEvent)
+
+// reloader holds what is needed to load the configuration again
+// in the same way as it was first loaded by before
+type reloader struct {
+	cmd       *cli.Command
+	sources   []string // As named by --config or found by discovery
+	binds     binder
+	flagNames []string
+}
+
+// configWatcher watches configuration files, and key-value sources,
+// for changes
+type configWatcher struct {
+	watcher *fsnotify.Watcher
+	mu      sync.Mutex // Guards files
+	files   []string
+	stops   []func()    // Stop watching each key-value source
+	changes chan string // The key-value sources which changed
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+var (
+	// current is the configuration most recently loaded
+	current atomic.Pointer[Configurator]
+
+	// reloadState is set once the configuration has been loaded
+	reloadState *reloader
+
+	// reloadLock serialises reloads of the configuration
+	reloadLock sync.Mutex
+
+	// reloadListeners holds the functions added by OnReload
+	reloadListeners []ReloadListener
+
+	// watchFiles is set by WatchConfig
+	watchFiles bool
+
+	// watching is the active watcher of configuration files, if any
+	watching atomic.Pointer[configWatcher]
+
+	// reloadDelay is how long changes to the configuration files must
+	// cease before the configuration is reloaded, as editors and
+	// deployment tools often write a file in several steps
+	reloadDelay = 250 * time.Millisecond
+)
+
+// WatchConfig is an Option which reloads the configuration whenever one of
+// the files named by --config (or found by discovery) changes, or a [KVSource]
+// read by a [KVLoader] reports a change beneath its prefix. The sources are
+// loaded into a new instance of the configuration struct, holding only its
+// defaults, in the same way as when the program started: command-line flag
+// values are applied again, and the result is validated. Only if every step
+// succeeds does [Current] return the new configuration, and the functions
+// registered by [OnReload] are called with the keys whose values changed.
+// Otherwise, the error is logged and the previous configuration remains in use.
+//
+// A field which cannot safely change while the program is running, such as
+// a listening address, can be tagged reload:"static". A reload which changes
+// such a field, or any field within it, fails; see [WarnOnStaticChanges].
+//
+// The struct passed to [Configuration] always holds the configuration as
+// it was first loaded, so a program which uses WatchConfig should obtain
+// the configuration from [Current]
+func WatchConfig() Option {
+	return func() error {
+		watchFiles = true
+		return nil
+	}
+}
+
+// OnReload is an Option which registers a function to be called, with the
+// old and new configurations and the differences between them, each time a
+// reload changes the configuration
+func OnReload(listener ReloadListener) Option {
+	return func() error {
+		if listener == nil {
+			return errors.New("OnReload requires a non-nil listener")
+		}
+		reloadListeners = append(reloadListeners, listener)
+		return nil
+	}
+}
+
+// Current returns the configuration most recently loaded. It is safe
+// to call from any goroutine, and returns nil before the configuration
+// has been loaded. The configuration returned must not be modified
+func Current() Configurator {
+	if cfg := current.Load(); cfg != nil {
+		return *cfg
+	}
+	return nil
+}
+
+// publish makes a configuration the one returned by Current
+func publish(cfg Configurator) {
+	publishSecrets(cfg)
+	if cfg == nil {
+		current.Store(nil)
+		return
+	}
+	current.Store(&cfg)
+}
+
+// reload loads the configuration again, publishes it and, if any value
+// changed, notifies the reload listeners. The configuration in use is
+// unchanged if it fails. A change to a field tagged reload:"static" is
+// a failure, unless WarnOnStaticChanges was used
+func reload(trigger string) ([]Change, error) {
+	reloadLock.Lock()
+	defer reloadLock.Unlock()
+	r := reloadState
+	if r == nil {
+		return nil, errors.New("the configuration has not been loaded")
+	}
+	if slices.Contains(r.sources, "-") {
+		return nil, errors.New("a configuration read from standard input cannot be reloaded")
+	}
+	saved := snapshotOrigins()
+	fresh, err := r.load()
+	// Watch any files newly named by extends or include, even if the
+	// configuration is invalid, so that it is reloaded once they are fixed
+	if cw := watching.Load(); cw != nil {
+		if werr := cw.watch(sourceFiles); werr != nil && !errors.Is(werr, fsnotify.ErrClosed) {
+			logger.Warn("Error watching configuration files", "error", werr.Error())
+		}
+	}
+	if err != nil {
+		restoreOrigins(saved)
+		return nil, err
+	}
+	old := Current()
+	changes := diffConfigs(old, fresh)
+	if static := staticKeys(changes); len(static) > 0 {
+		if !staticWarnOnly {
+			restoreOrigins(saved)
+			return nil, fmt.Errorf("static configuration keys cannot change until restart: %s", strings.Join(static, ", "))
+		}
+		logger.Warn("Static configuration keys changed, keeping their values until restart", "keys", static)
+		keepStatic(old, fresh, changes)
+		// The mix of old and new values must itself be valid
+		if err = validateConfig(fresh); err != nil {
+			restoreOrigins(saved)
+			return nil, fmt.Errorf("configuration validation failed with the static keys unchanged: [%w]", redactError(err))
+		}
+		changes = diffConfigs(old, fresh)
+	}
+	publish(fresh)
+	if len(changes) == 0 {
+		return nil, nil
+	}
+	for _, listener := range reloadListeners {
+		listener(ReloadEvent{Old: old, New: fresh, Trigger: trigger, Changes: changes})
+	}
+	return changes, nil
+}
+
+// load reads, parses, overrides with flag values and validates
+// a new instance of the configuration
+func (r *reloader) load() (Configurator, error) {
+	ls, err := loaders(r.sources)
+	if err != nil {
+		return nil, fmt.Errorf("config load error: [%w]", err)
+	}
+	if envConfig != nil {
+		ls = append(ls, envConfig.envLoader())
+	}
+	// Secrets are resolved afresh, as they may have been rotated
+	clearSecretCache()
+	fresh := clone(pristine)
+	if err = configure(fresh, ls); err != nil {
+		return nil, fmt.Errorf("configuration loading failed: [%w]", err)
+	}
+	binds, err := r.binds.rebind(fresh)
+	if err != nil {
+		return nil, fmt.Errorf("configuration handling failed: [%w]", err)
+	}
+	applyFlagOverrides(r.flagNames, binds)
+	recordFlagOrigins(r.cmd, fresh, r.flagNames, binds)
+	if err = validateConfig(fresh); err != nil {
+		return nil, fmt.Errorf("configuration validation failed: [%w]", redactError(err))
+	}
+	return fresh, nil
+}
+
+// reloadAndLog reloads the configuration, logging the result
+func reloadAndLog(trigger string) {
+	changes, err := reload(trigger)
+	if err != nil {
+		logger.Error("Configuration reload failed, keeping the previous configuration", "trigger", trigger, "error", err.Error())
+		return
+	}
+	logger.Info("Configuration reloaded", "trigger", trigger, "changed", changedKeys(changes))
+}
+
+// startWatching begins watching the files and key-value sources read by
+// a set of configuration loaders, together with the files which they extend
+// or include. The directory holding each file is watched, rather than the
+// file itself, so that files replaced by renaming a new version are still seen
+func startWatching(ls []configLoader) error {
+	stopWatching()
+	var (
+		files   []string
+		sources []*kvProvider
+	)
+	for _, l := range ls {
+		if kp, ok := l.Provider.(*kvProvider); ok {
+			sources = append(sources, kp)
+			continue
+		}
+		if l.Path == "" || l.Path == "-" || strings.Contains(l.Path, "://") {
+			continue
+		}
+		path, err := filepath.Abs(l.Path)
+		if err != nil {
+			return err
+		}
+		files = append(files, path)
+	}
+	files = append(files, sourceFiles...)
+	if len(files) == 0 && len(sources) == 0 {
+		return nil
+	}
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	cw := &configWatcher{
+		watcher: w,
+		changes: make(chan string, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if err = cw.watch(files); err != nil {
+		cw.close()
+		return err
+	}
+	for _, kp := range sources {
+		stop, err := kp.watch(func() {
+			select {
+			case cw.changes <- kp.path:
+			default:
+				// A reload is already pending
+			}
+		})
+		if err != nil {
+			cw.close()
+			return fmt.Errorf("cannot watch %s: %w", kp.path, err)
+		}
+		cw.stops = append(cw.stops, stop)
+	}
+	logger.Debug("watching configuration sources", "files", cw.files, "sources", len(sources))
+	watching.Store(cw)
+	go cw.run()
+	return nil
+}
+
+// stopWatching stops the watcher of configuration files, if there is one,
+// and waits for it to finish
+func stopWatching() {
+	cw := watching.Swap(nil)
+	if cw == nil {
+		return
+	}
+	cw.close()
+	close(cw.stop)
+	<-cw.done
+}
+
+// watch adds files to those being watched
+func (cw *configWatcher) watch(files []string) error {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+	for _, file := range files {
+		if slices.Contains(cw.files, file) {
+			continue
+		}
+		dir := filepath.Dir(file)
+		if err := cw.watcher.Add(dir); err != nil {
+			return fmt.Errorf("cannot watch %s: %w", dir, err)
+		}
+		cw.files = append(cw.files, file)
+	}
+	return nil
+}
+
+// watched reports whether a file is being watched
+func (cw *configWatcher) watched(file string) bool {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+	return slices.Contains(cw.files, file)
+}
+
+// close stops watching the files and key-value sources
+func (cw *configWatcher) close() {
+	for _, stop := range cw.stops {
+		stop()
+	}
+	cw.watcher.Close()
+}
+
+// run reloads the configuration each time one of the watched files or
+// key-value sources changes, once the changes have ceased for reloadDelay
+func (cw *configWatcher) run() {
+	defer close(cw.done)
+	var (
+		changed string
+		settled <-chan time.Time
+		events  = cw.watcher.Events
+		errs    = cw.watcher.Errors
+	)
+	for {
+		select {
+		case <-cw.stop:
+			return
+		case event, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			if cw.watched(filepath.Clean(event.Name)) && event.Op != fsnotify.Chmod {
+				changed = event.Name
+				settled = time.After(reloadDelay)
+			}
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			logger.Warn("Error watching configuration files", "error", err.Error())
+		case source := <-cw.changes:
+			changed = source
+			settled = time.After(reloadDelay)
+		case <-settled:
+			settled = nil
+			reloadAndLog(changed)
+		}
+	}
+}
@@ -0,0 +1,328 @@
+// Copyright © 2024 Bruce Smith <bruceesmith@gmail.com>
+// Use of this source code is governed by the MIT
+// License that can be found in the LICENSE file.
+
+package echidna
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/urfave/cli/v3"
+)
+
+type reloadConfig struct {
+	Name string `koanf:"name" validate:"required"`
+	Port int    `koanf:"port" validate:"min=1"`
+}
+
+func (r *reloadConfig) Validate() error { return nil }
+
+type reloadCollections struct {
+	Labels map[string]string `koanf:"labels" default:"a=1"`
+	Hosts  []string          `koanf:"hosts"`
+}
+
+func (r *reloadCollections) Validate() error { return nil }
+
+type reloadSecrets struct {
+	Password string `koanf:"password"`
+}
+
+func (r *reloadSecrets) Validate() error { return nil }
+
+// reloadCommand returns a command which loads a configuration, with
+// flags bound to its fields
+func reloadCommand(t *testing.T, cfg Configurator) *cli.Command {
+	cmd := &cli.Command{
+		Name:   "test",
+		Before: before,
+		Action: func(context.Context, *cli.Command) error {
+			return nil
+		},
+		Flags: []cli.Flag{
+			&cli.StringSliceFlag{
+				Name: "config",
+			},
+		},
+		Writer:    &bytes.Buffer{},
+		ErrWriter: &bytes.Buffer{},
+	}
+	if err := ConfigFlags([]Configurator{cfg}, cmd)(); err != nil {
+		t.Fatal(err)
+	}
+	configuration = cfg
+	pristine = clone(cfg)
+	configloaders = DefaultLoaders()
+	return cmd
+}
+
+func Test_WatchConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.yml")
+	if err := os.WriteFile(path, []byte("name: first\nport: 80\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	var cfg reloadConfig
+	cmd := reloadCommand(t, &cfg)
+	events := make(chan ReloadEvent, 10)
+	delay := reloadDelay
+	reloadDelay = 10 * time.Millisecond
+	defer func() {
+		stopWatching()
+		reloadDelay = delay
+		configuration = nil
+		pristine = nil
+		configloaders = nil
+		reloadListeners = nil
+		reloadState = nil
+		watchFiles = false
+		runArgs = nil
+		publish(nil)
+		resetOrigins()
+	}()
+	if err := WatchConfig()(); err != nil {
+		t.Fatal(err)
+	}
+	if err := OnReload(func(e ReloadEvent) { events <- e })(); err != nil {
+		t.Fatal(err)
+	}
+	runArgs = []string{"test", "--config", path, "--port=8080"}
+	if err := cmd.Run(context.Background(), runArgs); err != nil {
+		t.Fatalf("before() error = %v", err)
+	}
+	if Current() != Configurator(&cfg) {
+		t.Fatalf("Current() = %v, want the configuration first loaded", Current())
+	}
+
+	// A valid change is published, with the flag value still applied
+	if err := os.WriteFile(path, []byte("name: second\nport: 81\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case e := <-events:
+		old, _ := e.Old.(*reloadConfig)
+		updated, _ := e.New.(*reloadConfig)
+		if old != &cfg || updated == nil || *updated != (reloadConfig{Name: "second", Port: 8080}) {
+			t.Errorf("ReloadEvent = %+v, %+v", e.Old, e.New)
+		}
+		if e.Trigger != path {
+			t.Errorf("ReloadEvent.Trigger = %v, want %v", e.Trigger, path)
+		}
+		if Current() != e.New {
+			t.Errorf("Current() = %v, want %v", Current(), e.New)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the configuration was not reloaded")
+	}
+	if cfg.Name != "first" {
+		t.Errorf("reload changed the original configuration to %+v", cfg)
+	}
+	if origin, _ := OriginOf("port"); origin.Kind != OriginFlag {
+		t.Errorf("OriginOf(port) after reload = %v, want the flag", origin)
+	}
+
+	// An invalid change is not published
+	previous := Current()
+	if err := os.WriteFile(path, []byte("port: 81\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case e := <-events:
+		t.Errorf("an invalid configuration was published: %+v", e.New)
+	case <-time.After(200 * time.Millisecond):
+	}
+	if Current() != previous {
+		t.Errorf("Current() = %v after a failed reload, want %v", Current(), previous)
+	}
+	if _, err := reload("test"); err == nil {
+		t.Errorf("reload() of an invalid configuration did not fail")
+	}
+}
+
+func Test_WatchConfig_includes(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("app.yml", "include: shared/port.yml\nname: first\n")
+	write("shared/port.yml", "port: 80\n")
+	write("more/name.yml", "name: second\n")
+	var cfg reloadConfig
+	cmd := reloadCommand(t, &cfg)
+	events := make(chan ReloadEvent, 10)
+	delay := reloadDelay
+	reloadDelay = 10 * time.Millisecond
+	defer func() {
+		stopWatching()
+		reloadDelay = delay
+		configuration = nil
+		pristine = nil
+		configloaders = nil
+		reloadListeners = nil
+		reloadState = nil
+		watchFiles = false
+		runArgs = nil
+		sourceFiles = nil
+		publish(nil)
+		resetOrigins()
+	}()
+	if err := WatchConfig()(); err != nil {
+		t.Fatal(err)
+	}
+	if err := OnReload(func(e ReloadEvent) { events <- e })(); err != nil {
+		t.Fatal(err)
+	}
+	runArgs = []string{"test", "--config", filepath.Join(dir, "app.yml")}
+	if err := cmd.Run(context.Background(), runArgs); err != nil {
+		t.Fatalf("before() error = %v", err)
+	}
+	reloaded := func(want reloadConfig, trigger string) {
+		t.Helper()
+		select {
+		case e := <-events:
+			updated, _ := e.New.(*reloadConfig)
+			if updated == nil || *updated != want {
+				t.Errorf("ReloadEvent.New = %+v, want %+v", e.New, want)
+			}
+			if e.Trigger != filepath.Join(dir, trigger) {
+				t.Errorf("ReloadEvent.Trigger = %v, want %v", e.Trigger, trigger)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("the configuration was not reloaded after %v changed", trigger)
+		}
+	}
+
+	// An included file is watched
+	write("shared/port.yml", "port: 81\n")
+	reloaded(reloadConfig{Name: "first", Port: 81}, "shared/port.yml")
+
+	// As is a file which is included once the configuration is reloaded
+	write("app.yml", "include: [shared/port.yml, more/name.yml]\nname: first\n")
+	reloaded(reloadConfig{Name: "second", Port: 81}, "app.yml")
+	write("more/name.yml", "name: third\n")
+	reloaded(reloadConfig{Name: "third", Port: 81}, "more/name.yml")
+}
+
+func Test_reload_stdin(t *testing.T) {
+	reloadState = &reloader{sources: []string{"-"}}
+	defer func() { reloadState = nil }()
+	if _, err := reload("test"); err == nil {
+		t.Errorf("reload() of standard input did not fail")
+	}
+	reloadState = nil
+	if _, err := reload("test"); err == nil {
+		t.Errorf("reload() before loading did not fail")
+	}
+}
+
+func Test_reload_collections(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.yml")
+	if err := os.WriteFile(path, []byte("labels:\n  b: x\nhosts: [h1, h2]\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	var cfg reloadCollections
+	if err := applyDefaults(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	cmd := reloadCommand(t, &cfg)
+	defer func() {
+		configuration = nil
+		pristine = nil
+		configloaders = nil
+		reloadState = nil
+		runArgs = nil
+		publish(nil)
+		resetOrigins()
+	}()
+	runArgs = []string{"test", "--config", path}
+	if err := cmd.Run(context.Background(), runArgs); err != nil {
+		t.Fatalf("before() error = %v", err)
+	}
+	wantOld := reloadCollections{Labels: map[string]string{"a": "1", "b": "x"}, Hosts: []string{"h1", "h2"}}
+	if !reflect.DeepEqual(cfg, wantOld) {
+		t.Fatalf("before() loaded %+v, want %+v", cfg, wantOld)
+	}
+	if p, _ := pristine.(*reloadCollections); !reflect.DeepEqual(p.Labels, map[string]string{"a": "1"}) || len(p.Hosts) != 0 {
+		t.Errorf("loading changed the pristine configuration to %+v", p)
+	}
+
+	if err := os.WriteFile(path, []byte("labels:\n  c: y\nhosts: [h3]\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	changes, err := reload("test")
+	if err != nil {
+		t.Fatalf("reload() error = %v", err)
+	}
+	if len(changes) != 3 {
+		t.Errorf("reload() changes = %v, want labels.b, labels.c and hosts", changes)
+	}
+	if !reflect.DeepEqual(cfg, wantOld) {
+		t.Errorf("reload() changed the old configuration to %+v", cfg)
+	}
+	wantNew := reloadCollections{Labels: map[string]string{"a": "1", "c": "y"}, Hosts: []string{"h3"}}
+	if updated, _ := Current().(*reloadCollections); updated == nil || !reflect.DeepEqual(*updated, wantNew) {
+		t.Errorf("Current() = %+v, want %+v", Current(), wantNew)
+	}
+}
+
+func Test_reload_secrets(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.yml")
+	if err := os.WriteFile(path, []byte("password: secret://rotating/db\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	var version atomic.Int32
+	secretProviders["rotating"] = SecretProviderFunc(func(string) (string, error) {
+		return fmt.Sprintf("password-%d", version.Add(1)), nil
+	})
+	var cfg reloadSecrets
+	cmd := reloadCommand(t, &cfg)
+	defer func() {
+		delete(secretProviders, "rotating")
+		configuration = nil
+		pristine = nil
+		configloaders = nil
+		reloadState = nil
+		runArgs = nil
+		publish(nil)
+		resetOrigins()
+		resetSecrets()
+	}()
+	runArgs = []string{"test", "--config", path}
+	if err := cmd.Run(context.Background(), runArgs); err != nil {
+		t.Fatalf("before() error = %v", err)
+	}
+	if cfg.Password != "password-1" {
+		t.Fatalf("before() loaded %+v", cfg)
+	}
+
+	// Secrets are redacted while the configuration reloads
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range 100 {
+			redactText("password-1")
+		}
+	}()
+	for range 5 {
+		if _, err := reload("test"); err != nil {
+			t.Fatalf("reload() error = %v", err)
+		}
+	}
+	<-done
+	if updated, _ := Current().(*reloadSecrets); updated == nil || updated.Password != "password-6" {
+		t.Errorf("Current() = %+v, want the rotated password-6", Current())
+	}
+}
@@ -0,0 +1,478 @@
+// Copyright © 2024 Bruce Smith <bruceesmith@gmail.com>
+// Use of this source code is governed by the MIT
+// License that can be found in the LICENSE file.
+
+package echidna
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/netip"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// validateTag is the struct tag holding the validation rules of a field
+	validateTag = "validate"
+)
+
+// FieldError is the failure of a configuration value to satisfy one of
+// the rules in the validate tag of its field, or of the configuration to
+// satisfy a cross-field rule
+type FieldError struct {
+	Key     string // The path of the value, such as server.tls.cert_file
+	Rule    string // The rule that failed, such as "min=1" or "min_workers <= max_workers"
+	Message string // A description of the failure
+}
+
+// ValidationErrors holds every FieldError found in a configuration
+type ValidationErrors []*FieldError
+
+// rule is one comma-separated element of a validate tag, such as "min=1"
+type rule struct {
+	name string
+	arg  string
+}
+
+// ruleCheck describes how a validation rule is applied
+type ruleCheck struct {
+	arg     bool // The rule requires an argument
+	each    bool // The rule applies to each element of a slice, and is not applied to empty values
+	strings bool // The rule only applies to strings
+	check   func(v reflect.Value, arg string) string
+}
+
+var (
+	// hostnamePattern matches an RFC 1123 host name
+	hostnamePattern = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(\.[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*\.?$`)
+
+	// ruleChecks holds the validation rules that can be used in a validate tag
+	ruleChecks = map[string]ruleCheck{
+		"required":    {check: checkRequired},
+		"min":         {arg: true, check: checkMin},
+		"max":         {arg: true, check: checkMax},
+		"oneof":       {arg: true, each: true, check: checkOneOf},
+		"hostname":    {each: true, strings: true, check: checkHostname},
+		"url":         {each: true, strings: true, check: checkURL},
+		"uri":         {each: true, strings: true, check: checkURI},
+		"email":       {each: true, strings: true, check: checkEmail},
+		"ip":          {each: true, strings: true, check: checkIP},
+		"ipv4":        {each: true, strings: true, check: checkIPv4},
+		"ipv6":        {each: true, strings: true, check: checkIPv6},
+		"file_exists": {each: true, strings: true, check: checkFileExists},
+		"dir_exists":  {each: true, strings: true, check: checkDirExists},
+	}
+)
+
+// Error returns the key and the failure. The failure of
+// a cross-field rule has no key
+func (e *FieldError) Error() string {
+	if e.Key == "" {
+		return e.Message
+	}
+	return e.Key + ": " + e.Message
+}
+
+// Error returns every failure, separated by semicolons
+func (v ValidationErrors) Error() string {
+	messages := make([]string, len(v))
+	for i, e := range v {
+		messages[i] = e.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Unwrap returns the individual failures
+func (v ValidationErrors) Unwrap() []error {
+	result := make([]error, len(v))
+	for i, e := range v {
+		result[i] = e
+	}
+	return result
+}
+
+// String returns the rule as it appears in a validate tag
+func (r rule) String() string {
+	if r.arg == "" {
+		return r.name
+	}
+	return r.name + "=" + r.arg
+}
+
+// parseRules splits a validate tag into its rules
+func parseRules(tag string) []rule {
+	var rules []rule
+	for part := range strings.SplitSeq(tag, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, arg, _ := strings.Cut(part, "=")
+		rules = append(rules, rule{name: strings.TrimSpace(name), arg: strings.TrimSpace(arg)})
+	}
+	return rules
+}
+
+// checkRuleTags verifies that the validate tags of a configuration
+// struct name known rules, with arguments suited to their fields
+func checkRuleTags(cfg any) error {
+	return checkTypeRules(reflect.TypeOf(cfg), "", map[reflect.Type]bool{})
+}
+
+// checkTypeRules is a recursive function which checks the validate tags
+// of a struct type and of the structs within it
+func checkTypeRules(t reflect.Type, key string, seen map[reflect.Type]bool) error {
+	for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map {
+		t = t.Elem()
+	}
+	if !isNested(t) || seen[t] {
+		return nil
+	}
+	seen[t] = true
+	for _, r := range structRules(t) {
+		if _, err := r.compile(t); err != nil {
+			if key != "" {
+				err = fmt.Errorf("field %s: %w", key, err)
+			}
+			return err
+		}
+	}
+	for i := range t.NumField() {
+		field := t.Field(i)
+		name := keyName(field)
+		if name == "" {
+			continue
+		}
+		for _, r := range parseRules(field.Tag.Get(validateTag)) {
+			if err := r.verify(field.Type); err != nil {
+				return fmt.Errorf("field %s: %w", joinKey(key, name), err)
+			}
+		}
+		if err := checkTypeRules(field.Type, joinKey(key, name), seen); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// verify checks that a rule is known, and can be applied to a field of type t
+func (r rule) verify(t reflect.Type) error {
+	rc, ok := ruleChecks[r.name]
+	switch {
+	case !ok:
+		return fmt.Errorf("unknown validation rule %q", r.name)
+	case rc.arg && r.arg == "":
+		return fmt.Errorf("validation rule %q requires an argument", r.name)
+	case !rc.arg && r.arg != "":
+		return fmt.Errorf("validation rule %q does not take an argument", r.name)
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if rc.each && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+		t = t.Elem()
+	}
+	if rc.strings && t.Kind() != reflect.String {
+		return fmt.Errorf("validation rule %q requires a string", r.name)
+	}
+	if r.name != "min" && r.name != "max" {
+		return nil
+	}
+	switch {
+	case t == durationType:
+		if _, err := time.ParseDuration(r.arg); err != nil {
+			return fmt.Errorf("validation rule %q: %w", r, err)
+		}
+	case isNumber(t.Kind()), t.Kind() == reflect.String, t.Kind() == reflect.Slice, t.Kind() == reflect.Array, t.Kind() == reflect.Map:
+		if _, err := strconv.ParseFloat(r.arg, 64); err != nil {
+			return fmt.Errorf("validation rule %q requires a number", r)
+		}
+	default:
+		return fmt.Errorf("validation rule %q cannot be applied to a %s", r, t)
+	}
+	return nil
+}
+
+// validateConfig checks a configuration against the validate tags of its
+// struct and the cross-field rules given by ConfigRule or by rule tags. If
+// every value satisfies its rules, it calls the configuration's Validate method
+func validateConfig(cfg Configurator) error {
+	var errs ValidationErrors
+	applyRules(reflect.ValueOf(cfg), "", &errs)
+	for _, r := range configRules {
+		if err := r.evaluate(reflect.ValueOf(cfg), ""); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return cfg.Validate()
+}
+
+// applyRules is a recursive function which checks the values of a struct,
+// and of the structs within it, against the rules in their validate tags.
+// Each value that fails a rule is added to errs
+func applyRules(v reflect.Value, key string, errs *ValidationErrors) {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if !v.IsNil() {
+			applyRules(v.Elem(), key, errs)
+		}
+	case reflect.Struct:
+		if !isNested(v.Type()) {
+			return
+		}
+		for _, r := range structRules(v.Type()) {
+			if err := r.evaluate(v, key); err != nil {
+				*errs = append(*errs, err)
+			}
+		}
+		for i := range v.NumField() {
+			field := v.Type().Field(i)
+			name := keyName(field)
+			if name == "" {
+				continue
+			}
+			fieldKey := joinKey(key, name)
+			if err := applyFieldRules(v.Field(i), fieldKey, parseRules(field.Tag.Get(validateTag))); err != nil {
+				*errs = append(*errs, err)
+			}
+			applyRules(v.Field(i), fieldKey, errs)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := range v.Len() {
+			applyRules(v.Index(i), fmt.Sprintf("%s[%d]", key, i), errs)
+		}
+	case reflect.Map:
+		keys := v.MapKeys()
+		slices.SortFunc(keys, func(a, b reflect.Value) int {
+			return strings.Compare(fmt.Sprint(a.Interface()), fmt.Sprint(b.Interface()))
+		})
+		for _, k := range keys {
+			applyRules(v.MapIndex(k), joinKey(key, fmt.Sprint(k.Interface())), errs)
+		}
+	}
+}
+
+// applyFieldRules checks a value against each of the rules of its field,
+// returning the first failure
+func applyFieldRules(v reflect.Value, key string, rules []rule) *FieldError {
+	for _, r := range rules {
+		rc := ruleChecks[r.name]
+		if r.name == "required" && v.Kind() == reflect.Pointer {
+			// A pointer to a zero value is set, unlike a nil pointer
+			if v.IsNil() {
+				return &FieldError{Key: key, Rule: r.String(), Message: "is required"}
+			}
+			continue
+		}
+		for v.Kind() == reflect.Pointer && !v.IsNil() {
+			v = v.Elem()
+		}
+		if !rc.each {
+			if msg := rc.check(v, r.arg); msg != "" {
+				return &FieldError{Key: key, Rule: r.String(), Message: msg}
+			}
+			continue
+		}
+		if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+			if msg := r.checkEach(v); msg != "" {
+				return &FieldError{Key: key, Rule: r.String(), Message: msg}
+			}
+			continue
+		}
+		for i := range v.Len() {
+			if msg := r.checkEach(v.Index(i)); msg != "" {
+				return &FieldError{Key: fmt.Sprintf("%s[%d]", key, i), Rule: r.String(), Message: msg}
+			}
+		}
+	}
+	return nil
+}
+
+// checkEach applies a rule to a single value, which passes if it is empty
+func (r rule) checkEach(v reflect.Value) string {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	if v.IsZero() {
+		return ""
+	}
+	return ruleChecks[r.name].check(v, r.arg)
+}
+
+// isNumber reports whether a kind is an integer or floating point number
+func isNumber(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// checkRequired fails an empty value
+func checkRequired(v reflect.Value, _ string) string {
+	if !v.IsValid() || v.IsZero() || ((v.Kind() == reflect.Slice || v.Kind() == reflect.Map) && v.Len() == 0) {
+		return "is required"
+	}
+	return ""
+}
+
+// checkMin fails a number smaller than arg, or a string, slice
+// or map whose length is less than arg
+func checkMin(v reflect.Value, arg string) string {
+	size, limit, unit := measure(v, arg)
+	if size < limit {
+		return fmt.Sprintf("must be at least %s%s", arg, unit)
+	}
+	return ""
+}
+
+// checkMax fails a number larger than arg, or a string, slice
+// or map whose length is more than arg
+func checkMax(v reflect.Value, arg string) string {
+	size, limit, unit := measure(v, arg)
+	if size > limit {
+		return fmt.Sprintf("must be at most %s%s", arg, unit)
+	}
+	return ""
+}
+
+// measure returns the size of a value for the min and max rules, the limit
+// given by the rule's argument, and the unit in which the size is counted
+func measure(v reflect.Value, arg string) (size, limit float64, unit string) {
+	if v.Kind() == reflect.Pointer {
+		// A nil pointer has no value to compare
+		return 0, 0, ""
+	}
+	if v.Type() == durationType {
+		d, _ := time.ParseDuration(arg)
+		return float64(v.Int()), float64(d), ""
+	}
+	limit, _ = strconv.ParseFloat(arg, 64)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), limit, ""
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), limit, ""
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), limit, ""
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String())), limit, " characters long"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		unit = " entries"
+		if v.Kind() == reflect.Map {
+			unit = " keys"
+		}
+		return float64(v.Len()), limit, unit
+	}
+	return 0, 0, ""
+}
+
+// checkOneOf fails a value which is not one of the space-separated values in arg
+func checkOneOf(v reflect.Value, arg string) string {
+	allowed := strings.Fields(arg)
+	if !slices.Contains(allowed, fmt.Sprint(v.Interface())) {
+		return "must be one of " + strings.Join(allowed, ", ")
+	}
+	return ""
+}
+
+// checkHostname fails a string which is not a valid host name
+func checkHostname(v reflect.Value, _ string) string {
+	if s := v.String(); len(s) > 253 || !hostnamePattern.MatchString(s) {
+		return "must be a valid hostname"
+	}
+	return ""
+}
+
+// checkURL fails a string which is not an absolute URL with a host
+func checkURL(v reflect.Value, _ string) string {
+	if u, err := url.Parse(v.String()); err != nil || u.Scheme == "" || u.Host == "" {
+		return "must be a valid URL"
+	}
+	return ""
+}
+
+// checkURI fails a string which is not an absolute URI
+func checkURI(v reflect.Value, _ string) string {
+	if u, err := url.Parse(v.String()); err != nil || u.Scheme == "" {
+		return "must be a valid URI"
+	}
+	return ""
+}
+
+// checkEmail fails a string which is not a bare email address
+func checkEmail(v reflect.Value, _ string) string {
+	if a, err := mail.ParseAddress(v.String()); err != nil || a.Address != v.String() {
+		return "must be a valid email address"
+	}
+	return ""
+}
+
+// checkIP fails a string which is not an IP address
+func checkIP(v reflect.Value, _ string) string {
+	if _, err := netip.ParseAddr(v.String()); err != nil {
+		return "must be a valid IP address"
+	}
+	return ""
+}
+
+// checkIPv4 fails a string which is not an IPv4 address
+func checkIPv4(v reflect.Value, _ string) string {
+	if a, err := netip.ParseAddr(v.String()); err != nil || !a.Is4() {
+		return "must be a valid IPv4 address"
+	}
+	return ""
+}
+
+// checkIPv6 fails a string which is not an IPv6 address
+func checkIPv6(v reflect.Value, _ string) string {
+	if a, err := netip.ParseAddr(v.String()); err != nil || !a.Is6() {
+		return "must be a valid IPv6 address"
+	}
+	return ""
+}
+
+// checkFileExists fails a path which does not name an existing file
+func checkFileExists(v reflect.Value, _ string) string {
+	info, err := os.Stat(v.String())
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return fmt.Sprintf("file %s does not exist", v.String())
+	case err != nil:
+		return err.Error()
+	case info.IsDir():
+		return fmt.Sprintf("%s is a directory, not a file", v.String())
+	}
+	return ""
+}
+
+// checkDirExists fails a path which does not name an existing directory
+func checkDirExists(v reflect.Value, _ string) string {
+	info, err := os.Stat(v.String())
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return fmt.Sprintf("directory %s does not exist", v.String())
+	case err != nil:
+		return err.Error()
+	case !info.IsDir():
+		return fmt.Sprintf("%s is not a directory", v.String())
+	}
+	return ""
+}
@@ -0,0 +1,203 @@
+// Copyright © 2024 Bruce Smith <bruceesmith@gmail.com>
+// Use of this source code is governed by the MIT
+// License that can be found in the LICENSE file.
+
+package echidna
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type rulesTLS struct {
+	CertFile string `koanf:"cert_file" validate:"file_exists"`
+}
+
+type rulesServer struct {
+	Host string   `koanf:"host" validate:"required,hostname"`
+	Port int      `koanf:"port" validate:"min=1,max=65535"`
+	TLS  rulesTLS `koanf:"tls"`
+}
+
+type rulesConfig struct {
+	Mode     string        `koanf:"mode" validate:"oneof=dev prod"`
+	Server   rulesServer   `koanf:"server"`
+	Backends []rulesServer `koanf:"backends" validate:"max=2"`
+	Peers    []string      `koanf:"peers" validate:"ip"`
+	Endpoint string        `koanf:"endpoint" validate:"url"`
+	Admin    string        `koanf:"admin" validate:"email"`
+	Name     string        `koanf:"name" validate:"min=3"`
+	Timeout  time.Duration `koanf:"timeout" validate:"max=1m"`
+	Limit    *int          `koanf:"limit" validate:"required"`
+	checked  bool
+}
+
+func (r *rulesConfig) Validate() error {
+	r.checked = true
+	return nil
+}
+
+func Test_checkRuleTags(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     any
+		wantErr bool
+	}{
+		{
+			name: "ok",
+			cfg:  &rulesConfig{},
+		},
+		{
+			name: "unknown",
+			cfg: &struct {
+				A string `validate:"nonsense"`
+			}{},
+			wantErr: true,
+		},
+		{
+			name: "missing-argument",
+			cfg: &struct {
+				A int `validate:"min"`
+			}{},
+			wantErr: true,
+		},
+		{
+			name: "unexpected-argument",
+			cfg: &struct {
+				A string `validate:"hostname=x"`
+			}{},
+			wantErr: true,
+		},
+		{
+			name: "not-a-number",
+			cfg: &struct {
+				A int `validate:"max=many"`
+			}{},
+			wantErr: true,
+		},
+		{
+			name: "not-a-duration",
+			cfg: &struct {
+				A time.Duration `validate:"max=5"`
+			}{},
+			wantErr: true,
+		},
+		{
+			name: "not-a-string",
+			cfg: &struct {
+				A int `validate:"url"`
+			}{},
+			wantErr: true,
+		},
+		{
+			name: "nested",
+			cfg: &struct {
+				A []struct {
+					B bool `validate:"min=1"`
+				}
+			}{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkRuleTags(tt.cfg); (err != nil) != tt.wantErr {
+				t.Errorf("checkRuleTags() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_validateConfig(t *testing.T) {
+	cert := filepath.Join(t.TempDir(), "cert.pem")
+	if err := os.WriteFile(cert, []byte("cert"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	limit := 0
+	valid := func() *rulesConfig {
+		return &rulesConfig{
+			Mode:     "prod",
+			Server:   rulesServer{Host: "example.com", Port: 443, TLS: rulesTLS{CertFile: cert}},
+			Peers:    []string{"10.0.0.1", "::1"},
+			Endpoint: "https://example.com/api",
+			Admin:    "admin@example.com",
+			Name:     "app",
+			Timeout:  time.Second,
+			Limit:    &limit,
+		}
+	}
+	tests := []struct {
+		name   string
+		modify func(*rulesConfig)
+		want   ValidationErrors
+	}{
+		{
+			name:   "valid",
+			modify: func(*rulesConfig) {},
+		},
+		{
+			name: "empty-values-pass",
+			modify: func(r *rulesConfig) {
+				r.Mode, r.Endpoint, r.Admin, r.Peers, r.Server.TLS.CertFile = "", "", "", nil, ""
+			},
+		},
+		{
+			name: "every-failure",
+			modify: func(r *rulesConfig) {
+				r.Mode = "test"
+				r.Server = rulesServer{Port: 70000, TLS: rulesTLS{CertFile: cert + ".missing"}}
+				r.Backends = []rulesServer{{Host: "a", Port: 1}, {Host: "bad_host", Port: 2}, {Host: "c", Port: 3}}
+				r.Peers = []string{"10.0.0.1", "localhost"}
+				r.Endpoint = "example.com"
+				r.Admin = "Admin <admin@example.com>"
+				r.Name = "ab"
+				r.Timeout = time.Hour
+				r.Limit = nil
+			},
+			want: ValidationErrors{
+				{Key: "mode", Rule: "oneof=dev prod", Message: "must be one of dev, prod"},
+				{Key: "server.host", Rule: "required", Message: "is required"},
+				{Key: "server.port", Rule: "max=65535", Message: "must be at most 65535"},
+				{Key: "server.tls.cert_file", Rule: "file_exists", Message: "file " + cert + ".missing does not exist"},
+				{Key: "backends", Rule: "max=2", Message: "must be at most 2 entries"},
+				{Key: "backends[1].host", Rule: "hostname", Message: "must be a valid hostname"},
+				{Key: "peers[1]", Rule: "ip", Message: "must be a valid IP address"},
+				{Key: "endpoint", Rule: "url", Message: "must be a valid URL"},
+				{Key: "admin", Rule: "email", Message: "must be a valid email address"},
+				{Key: "name", Rule: "min=3", Message: "must be at least 3 characters long"},
+				{Key: "timeout", Rule: "max=1m", Message: "must be at most 1m"},
+				{Key: "limit", Rule: "required", Message: "is required"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := valid()
+			tt.modify(cfg)
+			err := validateConfig(cfg)
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("validateConfig() error = %v", err)
+				}
+				if !cfg.checked {
+					t.Errorf("validateConfig() did not call Validate")
+				}
+				return
+			}
+			var got ValidationErrors
+			if !errors.As(err, &got) {
+				t.Fatalf("validateConfig() error = %v, want ValidationErrors", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("validateConfig() =\n%v\nwant\n%v", got, tt.want)
+			}
+			if cfg.checked {
+				t.Errorf("validateConfig() called Validate despite failures")
+			}
+		})
+	}
+}
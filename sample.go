@@ -0,0 +1,230 @@
+// Copyright © 2024 Bruce Smith <bruceesmith@gmail.com>
+// Use of this source code is governed by the MIT
+// License that can be found in the LICENSE file.
+
+package echidna
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	gotoml "github.com/pelletier/go-toml"
+	"github.com/urfave/cli/v3"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// sampleEntry is one key of a sample configuration file
+type sampleEntry struct {
+	name     string
+	desc     string
+	value    any
+	children []sampleEntry // The keys of a nested struct, in field order
+	nested   bool
+}
+
+// initCommand returns the "config init" subcommand
+func initCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "init",
+		Usage:     "write a sample configuration file",
+		ArgsUsage: "[FILE]",
+		Description: "The sample holds every configuration key with its default value, and the\n" +
+			"description of each key as a comment (except in JSON, which has no comments).\n" +
+			"Secret values are left blank. Without FILE, the sample is written to standard output",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "format",
+				Usage: "format of the file: yaml, toml or json",
+				Value: "yaml",
+			},
+			&cli.BoolFlag{
+				Name:  "force",
+				Usage: "overwrite the file if it already exists",
+			},
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			if cmd.Args().Len() > 1 {
+				return fmt.Errorf("config init accepts at most one file")
+			}
+			out, err := sampleConfig(pristine, cmd.String("format"))
+			if err != nil {
+				return err
+			}
+			path := cmd.Args().First()
+			if path == "" || path == "-" {
+				_, err = cmd.Root().Writer.Write(out)
+				return err
+			}
+			if _, err = os.Stat(path); err == nil && !cmd.Bool("force") {
+				return fmt.Errorf("%s already exists; use --force to overwrite it", path)
+			} else if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+			return os.WriteFile(path, out, 0o600)
+		},
+	}
+}
+
+// sampleConfig returns a sample configuration file, in the requested
+// format, built from a configuration struct
+func sampleConfig(cfg any, format string) ([]byte, error) {
+	entries := sampleEntries(reflect.Indirect(reflect.ValueOf(cfg)), false)
+	switch strings.ToLower(format) {
+	case "yaml", "yml":
+		var buf bytes.Buffer
+		enc := yamlv3.NewEncoder(&buf)
+		enc.SetIndent(2)
+		node, err := yamlSample(entries)
+		if err != nil {
+			return nil, err
+		}
+		if err = enc.Encode(node); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), enc.Close()
+	case "toml":
+		tree, err := tomlSample(entries)
+		if err != nil {
+			return nil, err
+		}
+		out, err := tree.Marshal()
+		return out, err
+	case "json":
+		out, err := json.MarshalIndent(jsonSample(entries), "", "  ")
+		return append(out, '\n'), err
+	}
+	return nil, fmt.Errorf("unknown configuration format %q", format)
+}
+
+// sampleEntries walks a configuration struct, in the same way as the
+// flag bindings, to find its keys, their descriptions and their defaults.
+// The values of secret fields, and of every field within a secret struct,
+// are left blank. secret is true if v is itself a secret
+func sampleEntries(v reflect.Value, secret bool) []sampleEntry {
+	var entries []sampleEntry
+	for i := range v.NumField() {
+		field := v.Type().Field(i)
+		name := keyName(field)
+		if name == "" {
+			continue
+		}
+		entry := sampleEntry{name: name, desc: field.Tag.Get(opts.descTag)}
+		secret := secret || isSecretField(field)
+		switch {
+		case isNested(field.Type):
+			entry.nested = true
+			entry.children = sampleEntries(v.Field(i), secret)
+		case secret:
+			entry.value = plainValue(reflect.Zero(field.Type), "", false, false)
+		default:
+			entry.value = plainValue(v.Field(i), "", false, true)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// yamlSample builds a YAML mapping, with comments, from sample entries
+func yamlSample(entries []sampleEntry) (*yamlv3.Node, error) {
+	mapping := &yamlv3.Node{Kind: yamlv3.MappingNode}
+	for _, e := range entries {
+		key := &yamlv3.Node{Kind: yamlv3.ScalarNode, Value: e.name, HeadComment: e.desc}
+		value := &yamlv3.Node{}
+		if e.nested {
+			var err error
+			if value, err = yamlSample(e.children); err != nil {
+				return nil, err
+			}
+		} else if err := value.Encode(e.value); err != nil {
+			return nil, fmt.Errorf("%s: %w", e.name, err)
+		}
+		mapping.Content = append(mapping.Content, key, value)
+	}
+	return mapping, nil
+}
+
+// tomlSample builds a TOML tree, with comments, from sample entries
+func tomlSample(entries []sampleEntry) (*gotoml.Tree, error) {
+	tree, err := gotoml.TreeFromMap(map[string]any{})
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		value := tomlValue(e.value)
+		if e.nested {
+			if value, err = tomlSample(e.children); err != nil {
+				return nil, err
+			}
+		}
+		if value == nil {
+			continue // TOML has no null
+		}
+		tree.SetPathWithOptions([]string{e.name}, gotoml.SetOptions{Comment: e.desc}, value)
+	}
+	return tree, nil
+}
+
+// tomlValue converts a value into one of the types that go-toml can write
+func tomlValue(v any) any {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Invalid:
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return rv.Uint()
+	case reflect.Float32, reflect.Float64:
+		return rv.Float()
+	case reflect.Bool:
+		return rv.Bool()
+	case reflect.String:
+		return rv.String()
+	case reflect.Slice, reflect.Array:
+		result := make([]any, 0, rv.Len())
+		for i := range rv.Len() {
+			if e := tomlValue(rv.Index(i).Interface()); e != nil {
+				result = append(result, e)
+			}
+		}
+		return result
+	case reflect.Map:
+		m := make(map[string]any, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			if e := tomlValue(iter.Value().Interface()); e != nil {
+				m[fmt.Sprint(iter.Key().Interface())] = e
+			}
+		}
+		tree, err := gotoml.TreeFromMap(m)
+		if err != nil {
+			return nil
+		}
+		return tree
+	}
+	if t, ok := v.(time.Time); ok {
+		return t
+	}
+	return fmt.Sprint(v)
+}
+
+// jsonSample builds a JSON object from sample entries
+func jsonSample(entries []sampleEntry) map[string]any {
+	result := make(map[string]any, len(entries))
+	for _, e := range entries {
+		if e.nested {
+			result[e.name] = jsonSample(e.children)
+		} else {
+			result[e.name] = e.value
+		}
+	}
+	return result
+}
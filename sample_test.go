@@ -0,0 +1,215 @@
+// Copyright © 2024 Bruce Smith <bruceesmith@gmail.com>
+// Use of this source code is governed by the MIT
+// License that can be found in the LICENSE file.
+
+package echidna
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/knadh/koanf/parsers/json"
+	"github.com/knadh/koanf/parsers/toml"
+	"github.com/urfave/cli/v3"
+)
+
+type sampleServer struct {
+	Host string `koanf:"host" desc:"server host name"`
+	Port int    `koanf:"port" default:"8080" desc:"listening port"`
+}
+
+type sampleStruct struct {
+	Name     string        `koanf:"name" default:"app" desc:"application name"`
+	Server   sampleServer  `koanf:"server" desc:"the HTTP server"`
+	Password string        `koanf:"password" secret:"true" desc:"database password"`
+	Timeout  time.Duration `koanf:"timeout" default:"5s"`
+	Tags     []string      `koanf:"tags" default:"a,b"`
+}
+
+func (*sampleStruct) Validate() error { return nil }
+
+func Test_sampleConfig(t *testing.T) {
+	descTag := opts.descTag
+	opts.descTag = "desc"
+	defer func() { opts.descTag = descTag }()
+	cfg := sampleStruct{Password: "hunter2"}
+	if err := applyDefaults(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	parsed := map[string]any{
+		"name":     "app",
+		"server":   map[string]any{"host": "", "port": float64(8080)},
+		"password": "",
+		"timeout":  "5s",
+		"tags":     []any{"a", "b"},
+	}
+	tests := []struct {
+		name    string
+		format  string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "yaml",
+			format: "yaml",
+			want: `# application name
+name: app
+# the HTTP server
+server:
+  # server host name
+  host: ""
+  # listening port
+  port: 8080
+# database password
+password: ""
+timeout: 5s
+tags:
+  - a
+  - b
+`,
+		},
+		{
+			name:   "toml",
+			format: "TOML",
+			want: `
+# application name
+name = "app"
+
+# database password
+password = ""
+tags = ["a", "b"]
+timeout = "5s"
+
+# the HTTP server
+[server]
+
+  # server host name
+  host = ""
+
+  # listening port
+  port = 8080
+`,
+		},
+		{
+			name:   "json",
+			format: "json",
+		},
+		{
+			name:    "unknown",
+			format:  "xml",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := sampleConfig(&cfg, tt.format)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("sampleConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if tt.want != "" && string(got) != tt.want {
+				t.Errorf("sampleConfig() = %q, want %q", got, tt.want)
+			}
+			var m map[string]any
+			switch tt.format {
+			case "json":
+				m, err = json.Parser().Unmarshal(got)
+			case "TOML":
+				m, err = toml.Parser().Unmarshal(got)
+				m["server"].(map[string]any)["port"] = float64(m["server"].(map[string]any)["port"].(int64))
+			default:
+				return
+			}
+			if err != nil {
+				t.Fatalf("sampleConfig() output cannot be parsed: %v", err)
+			}
+			if !reflect.DeepEqual(m, parsed) {
+				t.Errorf("sampleConfig() parsed = %v, want %v", m, parsed)
+			}
+		})
+	}
+}
+
+type sampleSecrets struct {
+	Database struct {
+		User     string `koanf:"user" default:"admin"`
+		Password string `koanf:"password"`
+	} `koanf:"database" secret:"true"`
+}
+
+func (*sampleSecrets) Validate() error { return nil }
+
+func Test_sampleConfig_secretStruct(t *testing.T) {
+	cfg := sampleSecrets{}
+	if err := applyDefaults(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	cfg.Database.Password = "hunter2"
+	got, err := sampleConfig(&cfg, "yaml")
+	if err != nil {
+		t.Fatalf("sampleConfig() error = %v", err)
+	}
+	want := `database:
+  user: ""
+  password: ""
+`
+	if string(got) != want {
+		t.Errorf("sampleConfig() = %q, want %q", got, want)
+	}
+}
+
+func Test_configInit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.yml")
+	var cfg sampleStruct
+	if err := Configuration(&cfg, DefaultLoaders())(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ConfigCommand()(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		configuration = nil
+		configloaders = nil
+		pristine = nil
+		configCommands = nil
+		standaloneCommands.Clear()
+	}()
+	run := func(args ...string) (string, error) {
+		buf := &bytes.Buffer{}
+		cmd := &cli.Command{
+			Name:      "test",
+			Before:    before,
+			Flags:     []cli.Flag{&cli.StringSliceFlag{Name: "config"}},
+			Commands:  []*cli.Command{configCommand()},
+			Writer:    buf,
+			ErrWriter: buf,
+		}
+		err := cmd.Run(context.Background(), append([]string{"test"}, args...))
+		return buf.String(), err
+	}
+	if _, err := run("config", "init", path); err != nil {
+		t.Fatalf("config init error = %v", err)
+	}
+	first, _ := os.ReadFile(path)
+	if _, err := run("config", "init", "--format", "json", path); err == nil {
+		t.Errorf("config init overwrote an existing file")
+	}
+	if _, err := run("config", "init", "--format", "json", "--force", path); err != nil {
+		t.Errorf("config init --force error = %v", err)
+	}
+	second, _ := os.ReadFile(path)
+	if bytes.Equal(first, second) || second[0] != '{' {
+		t.Errorf("config init --force did not overwrite the file")
+	}
+	out, err := run("config", "init", "--format", "toml")
+	if err != nil || !bytes.Contains([]byte(out), []byte("port = 8080")) {
+		t.Errorf("config init to standard output = %q, %v", out, err)
+	}
+}
@@ -0,0 +1,282 @@
+// Copyright © 2024 Bruce Smith <bruceesmith@gmail.com>
+// Use of this source code is governed by the MIT
+// License that can be found in the LICENSE file.
+
+package echidna
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v3"
+)
+
+const (
+	// schemaDraft is the JSON Schema dialect generated by JSONSchema
+	schemaDraft = "https://json-schema.org/draft/2020-12/schema"
+)
+
+var (
+	// timeType is the type of time.Time
+	timeType = reflect.TypeFor[time.Time]()
+
+	// pointerEscaper escapes a name for use within a JSON Pointer
+	pointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+	// schemaFormats maps validate tag rules onto JSON Schema formats
+	schemaFormats = map[string]string{
+		"email":    "email",
+		"hostname": "hostname",
+		"ip":       "ip",
+		"ipv4":     "ipv4",
+		"ipv6":     "ipv6",
+		"uri":      "uri",
+		"url":      "uri",
+	}
+)
+
+// JSONSchema returns a JSON Schema describing the configuration files accepted
+// for a configuration struct. The schema holds the type of every key, with
+// nested structs as objects, the description of each key from the tag set by
+// [DescTag], the value currently held in each field as its default, and the
+// constraints of its validate tag:
+//
+//	required            the key must be present
+//	min=n, max=n        the minimum and maximum of a number, or the length of a string or list
+//	oneof=a b c         the value must be one of those listed
+//	email, hostname, ip, ipv4, ipv6, uri, url
+//	                    the format of a string
+//
+// Fields tagged secret:"true" are marked writeOnly. A struct type which
+// contains itself, such as a tree of nodes, is described once under $defs.
+// The schema can be used by editors and YAML language servers to complete
+// and check configuration files
+func JSONSchema(cfg Configurator) ([]byte, error) {
+	v := reflect.ValueOf(cfg)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("JSONSchema requires a pointer to a struct")
+	}
+	b := &schemaBuilder{
+		building: make(map[reflect.Type]bool),
+		defs:     make(map[string]any),
+		names:    make(map[reflect.Type]string),
+	}
+	schema := b.objectSchema(v.Elem())
+	if len(b.defs) > 0 {
+		schema["$defs"] = b.defs
+	}
+	schema["$schema"] = schemaDraft
+	schema["title"] = v.Elem().Type().Name()
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+// schemaBuilder generates the schema of a configuration struct
+type schemaBuilder struct {
+	building map[reflect.Type]bool   // The struct types being described
+	defs     map[string]any          // The schemas of recursive struct types
+	names    map[reflect.Type]string // The name of each struct type in defs
+}
+
+// objectSchema returns the schema of a struct, using the values of its
+// fields as defaults. A struct within itself is a reference to its schema
+// in $defs, which is added once the outermost struct is complete
+func (b *schemaBuilder) objectSchema(v reflect.Value) map[string]any {
+	t := v.Type()
+	if b.building[t] {
+		name := b.defName(t)
+		if _, ok := b.defs[name]; !ok {
+			b.defs[name] = nil
+		}
+		return map[string]any{"$ref": "#/$defs/" + pointerEscaper.Replace(name)}
+	}
+	b.building[t] = true
+	defer delete(b.building, t)
+	schema := b.fieldsSchema(v)
+	if name, ok := b.names[t]; ok && b.defs[name] == nil {
+		b.defs[name] = b.fieldsSchema(reflect.New(t).Elem())
+	}
+	return schema
+}
+
+// defName returns the name under which a struct type is described in
+// $defs: its package path and name, made unique if types declared within
+// different functions share them
+func (b *schemaBuilder) defName(t reflect.Type) string {
+	if name, ok := b.names[t]; ok {
+		return name
+	}
+	base := t.PkgPath() + "." + t.Name()
+	name := base
+	for n := 2; slices.Contains(slices.Collect(maps.Values(b.names)), name); n++ {
+		name = base + "-" + strconv.Itoa(n)
+	}
+	b.names[t] = name
+	return name
+}
+
+// fieldsSchema returns the schema of the fields of a struct
+func (b *schemaBuilder) fieldsSchema(v reflect.Value) map[string]any {
+	properties := make(map[string]any)
+	var required []string
+	for i := range v.NumField() {
+		field := v.Type().Field(i)
+		name := keyName(field)
+		if name == "" {
+			continue
+		}
+		var prop map[string]any
+		if isNested(field.Type) {
+			prop = b.objectSchema(v.Field(i))
+		} else {
+			prop = b.typeSchema(field.Type)
+			if !v.Field(i).IsZero() && !isSecretField(field) {
+				prop["default"] = plainValue(v.Field(i), "", false, true)
+			}
+		}
+		if desc := field.Tag.Get(opts.descTag); desc != "" {
+			prop["description"] = desc
+		}
+		if isSecretField(field) {
+			prop["writeOnly"] = true
+		}
+		for _, r := range parseRules(field.Tag.Get(validateTag)) {
+			if r.name == "required" {
+				required = append(required, name)
+				continue
+			}
+			constrain(prop, field.Type, r)
+		}
+		properties[name] = prop
+	}
+	schema := map[string]any{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// typeSchema returns the schema of a Go type
+func (b *schemaBuilder) typeSchema(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t == durationType:
+		return map[string]any{"type": "string", "pattern": `^([-+]?([0-9]*(\.[0-9]*)?[a-zµ]+)+|0)$`}
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case reflect.PointerTo(t).Implements(textUnmarshaler):
+		return map[string]any{"type": "string"}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]any{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string"}
+		}
+		return map[string]any{"type": "array", "items": b.typeSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": b.typeSchema(t.Elem())}
+	case reflect.Struct:
+		return b.objectSchema(reflect.New(t).Elem())
+	}
+	return map[string]any{}
+}
+
+// constrain adds the constraint expressed by a validate rule to a schema.
+// A rule which applies to each element of a list constrains its items
+func constrain(schema map[string]any, t reflect.Type, r rule) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if items, ok := schema["items"].(map[string]any); ok && ruleChecks[r.name].each {
+		constrain(items, t.Elem(), r)
+		return
+	}
+	if format, ok := schemaFormats[r.name]; ok {
+		schema["format"] = format
+		return
+	}
+	switch r.name {
+	case "oneof":
+		var enum []any
+		for value := range strings.FieldsSeq(r.arg) {
+			enum = append(enum, enumValue(t, value))
+		}
+		schema["enum"] = enum
+	case "min", "max":
+		n, err := strconv.ParseFloat(r.arg, 64)
+		if err != nil {
+			return
+		}
+		var keyword string
+		switch t.Kind() {
+		case reflect.String:
+			keyword = "Length"
+		case reflect.Slice, reflect.Array:
+			keyword = "Items"
+		case reflect.Map:
+			keyword = "Properties"
+		}
+		prefix := "minimum"
+		if r.name == "max" {
+			prefix = "maximum"
+		}
+		if keyword != "" {
+			prefix = r.name + keyword
+		}
+		schema[prefix] = n
+	}
+}
+
+// enumValue converts one of the values of a oneof rule into
+// the type of the field, for use in a schema
+func enumValue(t reflect.Type, value string) any {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return n
+		}
+	case reflect.Float32, reflect.Float64:
+		if n, err := strconv.ParseFloat(value, 64); err == nil {
+			return n
+		}
+	}
+	return value
+}
+
+// schemaCommand returns the "config schema" subcommand
+func schemaCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "schema",
+		Usage: "print a JSON Schema for the configuration",
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			schema, err := JSONSchema(pristine)
+			if err != nil {
+				return err
+			}
+			_, err = fmt.Fprintln(cmd.Root().Writer, string(schema))
+			return err
+		},
+	}
+}
@@ -0,0 +1,225 @@
+// Copyright © 2024 Bruce Smith <bruceesmith@gmail.com>
+// Use of this source code is governed by the MIT
+// License that can be found in the LICENSE file.
+
+package echidna
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/urfave/cli/v3"
+)
+
+type schemaTLS struct {
+	Enabled bool   `koanf:"enabled"`
+	Cert    string `koanf:"cert_file" validate:"file_exists"`
+}
+
+type schemaStruct struct {
+	Host     string            `koanf:"host" desc:"host name" validate:"required,hostname"`
+	Port     uint16            `koanf:"port" default:"8080" validate:"min=1,max=65535"`
+	Mode     string            `koanf:"mode" default:"dev" validate:"oneof=dev prod"`
+	Level    int               `koanf:"level" validate:"oneof=1 2 3"`
+	Password string            `koanf:"password" secret:"true" default:"hunter2"`
+	Timeout  time.Duration     `koanf:"timeout" default:"5s"`
+	Ratio    float64           `koanf:"ratio"`
+	Tags     []string          `koanf:"tags" validate:"min=1"`
+	Modes    []string          `koanf:"modes" default:"a" validate:"min=1,oneof=a b,hostname"`
+	Labels   map[string]string `koanf:"labels"`
+	TLS      schemaTLS         `koanf:"tls" desc:"TLS settings"`
+	Ignored  string            `koanf:"-"`
+}
+
+func (*schemaStruct) Validate() error { return nil }
+
+func TestJSONSchema(t *testing.T) {
+	descTag := opts.descTag
+	opts.descTag = "desc"
+	defer func() { opts.descTag = descTag }()
+	cfg := &schemaStruct{}
+	if err := applyDefaults(cfg); err != nil {
+		t.Fatal(err)
+	}
+	b, err := JSONSchema(cfg)
+	if err != nil {
+		t.Fatalf("JSONSchema() error = %v", err)
+	}
+	var got map[string]any
+	if err = json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("JSONSchema() is not JSON: %v", err)
+	}
+	want := map[string]any{
+		"$schema":  schemaDraft,
+		"title":    "schemaStruct",
+		"type":     "object",
+		"required": []any{"host"},
+		"properties": map[string]any{
+			"host":     map[string]any{"type": "string", "description": "host name", "format": "hostname"},
+			"port":     map[string]any{"type": "integer", "minimum": 1.0, "maximum": 65535.0, "default": 8080.0},
+			"mode":     map[string]any{"type": "string", "enum": []any{"dev", "prod"}, "default": "dev"},
+			"level":    map[string]any{"type": "integer", "enum": []any{1.0, 2.0, 3.0}},
+			"password": map[string]any{"type": "string", "writeOnly": true},
+			"timeout":  map[string]any{"type": "string", "pattern": `^([-+]?([0-9]*(\.[0-9]*)?[a-zµ]+)+|0)$`, "default": "5s"},
+			"ratio":    map[string]any{"type": "number"},
+			"tags":     map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "minItems": 1.0},
+			"modes": map[string]any{
+				"type":     "array",
+				"items":    map[string]any{"type": "string", "enum": []any{"a", "b"}, "format": "hostname"},
+				"minItems": 1.0,
+				"default":  []any{"a"},
+			},
+			"labels": map[string]any{"type": "object", "additionalProperties": map[string]any{"type": "string"}},
+			"tls": map[string]any{
+				"type":        "object",
+				"description": "TLS settings",
+				"properties": map[string]any{
+					"enabled":   map[string]any{"type": "boolean"},
+					"cert_file": map[string]any{"type": "string"},
+				},
+			},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("JSONSchema() = %s", b)
+	}
+	// The default of a list satisfies the constraints on its items
+	modes := got["properties"].(map[string]any)["modes"].(map[string]any)
+	for _, m := range modes["default"].([]any) {
+		if !slices.Contains(modes["items"].(map[string]any)["enum"].([]any), m) {
+			t.Errorf("JSONSchema() default %v is not among the items allowed", m)
+		}
+	}
+	if _, err = JSONSchema(nil); err == nil {
+		t.Errorf("JSONSchema(nil) succeeded")
+	}
+}
+
+type schemaNode struct {
+	Name     string       `koanf:"name"`
+	Parent   *schemaNode  `koanf:"parent"`
+	Children []schemaNode `koanf:"children"`
+}
+
+type schemaTree struct {
+	Root schemaNode `koanf:"root"`
+}
+
+func (*schemaTree) Validate() error { return nil }
+
+func TestJSONSchema_recursive(t *testing.T) {
+	b, err := JSONSchema(&schemaTree{Root: schemaNode{Name: "top"}})
+	if err != nil {
+		t.Fatalf("JSONSchema() error = %v", err)
+	}
+	var got map[string]any
+	if err = json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("JSONSchema() is not JSON: %v", err)
+	}
+	ref := map[string]any{"$ref": "#/$defs/github.com~1bruceesmith~1echidna.schemaNode"}
+	node := func(name map[string]any) map[string]any {
+		return map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"name":     name,
+				"parent":   ref,
+				"children": map[string]any{"type": "array", "items": ref},
+			},
+		}
+	}
+	want := map[string]any{
+		"$schema": schemaDraft,
+		"title":   "schemaTree",
+		"type":    "object",
+		"properties": map[string]any{
+			"root": node(map[string]any{"type": "string", "default": "top"}),
+		},
+		"$defs": map[string]any{
+			"github.com/bruceesmith/echidna.schemaNode": node(map[string]any{"type": "string"}),
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("JSONSchema() = %s", b)
+	}
+}
+
+// sameNameTypes returns two different recursive types, both named node
+func sameNameTypes() (any, any) {
+	type node struct {
+		Next *node `koanf:"next"`
+	}
+	first := node{}
+	{
+		type node struct {
+			Name string `koanf:"name"`
+			Next *node  `koanf:"next"`
+		}
+		return first, node{}
+	}
+}
+
+func TestJSONSchema_sameName(t *testing.T) {
+	first, second := sameNameTypes()
+	cfg := reflect.New(reflect.StructOf([]reflect.StructField{
+		{Name: "First", Type: reflect.TypeOf(first), Tag: `koanf:"first"`},
+		{Name: "Second", Type: reflect.TypeOf(second), Tag: `koanf:"second"`},
+	}))
+	b := &schemaBuilder{
+		building: make(map[reflect.Type]bool),
+		defs:     make(map[string]any),
+		names:    make(map[reflect.Type]string),
+	}
+	schema := b.objectSchema(cfg.Elem())
+	if len(b.defs) != 2 {
+		t.Fatalf("objectSchema() $defs = %v, want two types", b.defs)
+	}
+	refs := make(map[any]bool)
+	for _, key := range []string{"first", "second"} {
+		next := schema["properties"].(map[string]any)[key].(map[string]any)["properties"].(map[string]any)["next"]
+		refs[next.(map[string]any)["$ref"]] = true
+	}
+	if len(refs) != 2 {
+		t.Errorf("objectSchema() referred to %v, want two different $defs", refs)
+	}
+}
+
+func Test_configSchema(t *testing.T) {
+	var cfg config
+	if err := Configuration(&cfg, DefaultLoaders())(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ConfigCommand()(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		configuration = nil
+		configloaders = nil
+		pristine = nil
+		configCommands = nil
+		standaloneCommands.Clear()
+	}()
+	buf := &bytes.Buffer{}
+	cmd := &cli.Command{
+		Name:      "test",
+		Before:    before,
+		Flags:     []cli.Flag{&cli.StringSliceFlag{Name: "config"}},
+		Commands:  []*cli.Command{configCommand()},
+		Writer:    buf,
+		ErrWriter: buf,
+	}
+	if err := cmd.Run(context.Background(), []string{"test", "config", "schema"}); err != nil {
+		t.Fatalf("config schema error = %v", err)
+	}
+	var got map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("config schema wrote %q: %v", buf.String(), err)
+	}
+	if _, ok := got["properties"].(map[string]any)["i"]; !ok {
+		t.Errorf("config schema = %s, want a property i", buf.String())
+	}
+}
@@ -0,0 +1,303 @@
+// Copyright © 2024 Bruce Smith <bruceesmith@gmail.com>
+// Use of this source code is governed by the MIT
+// License that can be found in the LICENSE file.
+
+package echidna
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/bruceesmith/logger"
+	set "github.com/deckarep/golang-set/v2"
+	"github.com/knadh/koanf/providers/confmap"
+	"github.com/knadh/koanf/v2"
+)
+
+const (
+	// secretScheme prefixes a configuration value which refers to a secret
+	secretScheme = "secret://"
+)
+
+// SecretProvider resolves references to secrets. A configuration value of the
+// form secret://<name>/<reference> is replaced by the result of calling Resolve
+// on the SecretProvider registered as <name>, passing it <reference>
+type SecretProvider interface {
+	Resolve(reference string) (string, error)
+}
+
+// SecretProviderFunc is an adapter which allows an ordinary function
+// to be used as a [SecretProvider]
+type SecretProviderFunc func(reference string) (string, error)
+
+// Resolve calls f(reference)
+func (f SecretProviderFunc) Resolve(reference string) (string, error) {
+	return f(reference)
+}
+
+var (
+	// secretProviders is the registry of SecretProviders, indexed by name
+	secretProviders = builtinSecretProviders()
+
+	// secretCache holds the secrets already resolved during this run,
+	// indexed by their full reference
+	secretCache = make(map[string]string)
+
+	// secretLock guards secretCache, which is read when logging
+	// while the configuration may be reloading
+	secretLock sync.Mutex
+
+	// secretKeys holds the configuration keys whose values were
+	// resolved from secrets
+	secretKeys = set.NewSet[string]()
+)
+
+// RegisterSecretProvider is an Option which adds a [SecretProvider] to the
+// registry under name, replacing any provider already registered by that name.
+// The env and keyring providers are always registered:
+//
+//	secret://env/DB_PASS           the value of an environment variable
+//	secret://keyring/app/db        the password of account db for service app in the keyring of the user
+//
+// The keyring is read with secret-tool (libsecret) on Linux and other Unix
+// systems, and with security on macOS. It is not supported on Windows.
+//
+// The file and exec providers read files and run commands on the host, which
+// a configuration from an untrusted source must not be able to do, so they are
+// only registered by [EnableFileSecrets] and [EnableExecSecrets]
+func RegisterSecretProvider(name string, provider SecretProvider) Option {
+	return func() error {
+		if name == "" || strings.Contains(name, "/") {
+			return fmt.Errorf("invalid secret provider name %q", name)
+		}
+		if provider == nil {
+			return fmt.Errorf("secret provider %s is nil", name)
+		}
+		secretProviders[name] = provider
+		return nil
+	}
+}
+
+// EnableFileSecrets is an Option which registers the file secret provider:
+//
+//	secret://file/run/secrets/db   the content of the file /run/secrets/db, less any trailing newline
+func EnableFileSecrets() Option {
+	return RegisterSecretProvider("file", SecretProviderFunc(fileSecret))
+}
+
+// EnableExecSecrets is an Option which registers the exec secret provider:
+//
+//	secret://exec/pass show db     the output of a command, which is run directly rather than by a shell
+//
+// Any configuration source can then run commands, so it should only be
+// used when every source is trusted
+func EnableExecSecrets() Option {
+	return RegisterSecretProvider("exec", SecretProviderFunc(execSecret))
+}
+
+// builtinSecretProviders returns the SecretProviders registered by default
+func builtinSecretProviders() map[string]SecretProvider {
+	return map[string]SecretProvider{
+		"env":     SecretProviderFunc(envSecret),
+		"keyring": SecretProviderFunc(keyringSecret),
+	}
+}
+
+// resolveSecrets returns a copy of a configuration in which every
+// value that refers to a secret is replaced by the secret
+func resolveSecrets(k *koanf.Koanf) (*koanf.Koanf, error) {
+	resolved, err := walkStrings(k.Raw(), "", func(key, s string) (any, error) {
+		if !strings.HasPrefix(s, secretScheme) {
+			return s, nil
+		}
+		secret, err := resolveSecret(s)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		secretKeys.Add(key)
+		return secret, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	result := koanf.New(".")
+	err = result.Load(confmap.Provider(resolved, ""), nil)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// resolveSecret resolves a single secret reference, using the cached
+// value if the reference has already been resolved
+func resolveSecret(ref string) (string, error) {
+	secretLock.Lock()
+	secret, ok := secretCache[ref]
+	secretLock.Unlock()
+	if ok {
+		return secret, nil
+	}
+	name, reference, _ := strings.Cut(strings.TrimPrefix(ref, secretScheme), "/")
+	provider, ok := secretProviders[name]
+	if !ok {
+		return "", fmt.Errorf("no secret provider named %q", name)
+	}
+	secret, err := provider.Resolve(reference)
+	if err != nil {
+		return "", fmt.Errorf("secret provider %s failed: [%w]", name, err)
+	}
+	secretLock.Lock()
+	secretCache[ref] = secret
+	secretLock.Unlock()
+	logger.Debug("resolved secret", "provider", name)
+	return secret, nil
+}
+
+// isSecret reports whether the value of a configuration key, or of
+// the key containing it, was resolved from a secret
+func isSecret(key string) bool {
+	for {
+		if secretKeys.Contains(key) {
+			return true
+		}
+		i := strings.LastIndexAny(key, ".[")
+		if i < 0 {
+			return false
+		}
+		key = key[:i]
+	}
+}
+
+// resetSecrets forgets the secrets resolved during a run
+func resetSecrets() {
+	clearSecretCache()
+	secretKeys.Clear()
+}
+
+// clearSecretCache forgets the values of the secrets resolved so far, so
+// that they are resolved again, picking up any which have been rotated
+func clearSecretCache() {
+	secretLock.Lock()
+	defer secretLock.Unlock()
+	secretCache = make(map[string]string)
+}
+
+// cachedSecrets returns the values of the secrets resolved so far
+func cachedSecrets() []string {
+	secretLock.Lock()
+	defer secretLock.Unlock()
+	return slices.Collect(maps.Values(secretCache))
+}
+
+// envSecret reads a secret from an environment variable
+func envSecret(name string) (string, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", name)
+	}
+	return value, nil
+}
+
+// execSecret runs a command and returns its output as the secret
+func execSecret(command string) (string, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return "", errors.New("no command given")
+	}
+	return commandOutput(exec.Command(args[0], args[1:]...))
+}
+
+// keyringSecret reads a password from the keyring of the user. The
+// reference names the service and then the account, as in app/db
+func keyringSecret(reference string) (string, error) {
+	service, account, _ := strings.Cut(reference, "/")
+	if service == "" || account == "" {
+		return "", fmt.Errorf("keyring reference %q is not of the form service/account", reference)
+	}
+	switch runtime.GOOS {
+	case "darwin":
+		return commandOutput(exec.Command("security", "find-generic-password", "-s", service, "-a", account, "-w"))
+	case "windows":
+		return "", errors.New("the keyring is not supported on Windows")
+	}
+	return commandOutput(exec.Command("secret-tool", "lookup", "service", service, "account", account))
+}
+
+// commandOutput runs a command and returns its output, less any trailing
+// newline. The error output of a failed command is added to its error
+func commandOutput(cmd *exec.Cmd) (string, error) {
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%w: %s", err, msg)
+		}
+		return "", err
+	}
+	return strings.TrimRight(string(out), "\r\n"), nil
+}
+
+// fileSecret reads a secret from a file. The reference is the path of
+// the file without its leading separator
+func fileSecret(path string) (string, error) {
+	b, err := os.ReadFile(string(os.PathSeparator) + path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+// walkStrings returns a copy of a configuration map in which every string
+// value, including those within lists, is replaced by the result of fn. The
+// key passed to fn is the path of the value, such as "servers[1].host"
+func walkStrings(m map[string]any, prefix string, fn func(key, s string) (any, error)) (map[string]any, error) {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	result := make(map[string]any, len(m))
+	for _, name := range names {
+		key := name
+		if prefix != "" {
+			key = prefix + "." + name
+		}
+		v, err := walkValue(m[name], key, fn)
+		if err != nil {
+			return nil, err
+		}
+		result[name] = v
+	}
+	return result, nil
+}
+
+// walkValue applies fn to every string within a single configuration value
+func walkValue(v any, key string, fn func(key, s string) (any, error)) (any, error) {
+	switch t := v.(type) {
+	case string:
+		return fn(key, t)
+	case map[string]any:
+		return walkStrings(t, key, fn)
+	case []any:
+		result := make([]any, len(t))
+		for i, e := range t {
+			ev, err := walkValue(e, fmt.Sprintf("%s[%d]", key, i), fn)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = ev
+		}
+		return result, nil
+	}
+	return v, nil
+}
@@ -0,0 +1,243 @@
+// Copyright © 2024 Bruce Smith <bruceesmith@gmail.com>
+// Use of this source code is governed by the MIT
+// License that can be found in the LICENSE file.
+
+package echidna
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/knadh/koanf/providers/confmap"
+	"github.com/knadh/koanf/v2"
+)
+
+func TestRegisterSecretProvider(t *testing.T) {
+	provider := SecretProviderFunc(func(string) (string, error) { return "", nil })
+	tests := []struct {
+		name     string
+		provider string
+		arg      SecretProvider
+		wantErr  bool
+	}{
+		{
+			name:     "ok",
+			provider: "vault",
+			arg:      provider,
+		},
+		{
+			name:     "empty",
+			provider: "",
+			arg:      provider,
+			wantErr:  true,
+		},
+		{
+			name:     "slash",
+			provider: "a/b",
+			arg:      provider,
+			wantErr:  true,
+		},
+		{
+			name:     "nil",
+			provider: "vault",
+			arg:      nil,
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := RegisterSecretProvider(tt.provider, tt.arg)()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("RegisterSecretProvider() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if _, ok := secretProviders[tt.provider]; ok != !tt.wantErr {
+				t.Errorf("RegisterSecretProvider() registered = %v, want %v", ok, !tt.wantErr)
+			}
+			delete(secretProviders, "vault")
+		})
+	}
+}
+
+func TestEnableHostSecrets(t *testing.T) {
+	defer func() { secretProviders = builtinSecretProviders() }()
+	for _, name := range []string{"file", "exec"} {
+		if _, ok := secretProviders[name]; ok {
+			t.Errorf("the %s secret provider is registered by default", name)
+		}
+	}
+	if _, ok := secretProviders["keyring"]; !ok {
+		t.Errorf("the keyring secret provider is not registered by default")
+	}
+	if _, err := resolveSecret("secret://exec/echo hello"); err == nil {
+		t.Errorf("resolveSecret() ran a command without EnableExecSecrets")
+	}
+	for name, option := range map[string]Option{"file": EnableFileSecrets(), "exec": EnableExecSecrets()} {
+		if err := option(); err != nil {
+			t.Fatalf("Enable %s error = %v", name, err)
+		}
+		if _, ok := secretProviders[name]; !ok {
+			t.Errorf("the %s secret provider was not registered", name)
+		}
+	}
+}
+
+func Test_resolveSecrets(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	if err := os.WriteFile(path, []byte("file-secret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("ECHIDNA_SECRET", "env-secret")
+	calls := 0
+	secretProviders["test"] = SecretProviderFunc(func(ref string) (string, error) {
+		calls++
+		if ref == "fail" {
+			return "", errors.New("refused")
+		}
+		return strings.ToUpper(ref), nil
+	})
+	if err := EnableFileSecrets()(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { secretProviders = builtinSecretProviders() }()
+	tests := []struct {
+		name    string
+		values  map[string]any
+		want    map[string]any
+		secrets []string
+		wantErr string
+	}{
+		{
+			name: "builtin",
+			values: map[string]any{
+				"db": map[string]any{
+					"password": "secret://file" + filepath.ToSlash(path),
+					"user":     "secret://env/ECHIDNA_SECRET",
+					"host":     "localhost",
+				},
+			},
+			want: map[string]any{
+				"db": map[string]any{"password": "file-secret", "user": "env-secret", "host": "localhost"},
+			},
+			secrets: []string{"db.password", "db.user"},
+		},
+		{
+			name:    "registered",
+			values:  map[string]any{"tokens": []any{"plain", "secret://test/abc"}},
+			want:    map[string]any{"tokens": []any{"plain", "ABC"}},
+			secrets: []string{"tokens[1]"},
+		},
+		{
+			name:    "unknown",
+			values:  map[string]any{"a": "secret://nope/x"},
+			wantErr: `a: no secret provider named "nope"`,
+		},
+		{
+			name:    "failed",
+			values:  map[string]any{"a": "secret://test/fail"},
+			wantErr: "refused",
+		},
+		{
+			name:    "env-missing",
+			values:  map[string]any{"a": "secret://env/ECHIDNA_NO_SUCH_SECRET"},
+			wantErr: "ECHIDNA_NO_SUCH_SECRET is not set",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer resetSecrets()
+			k := koanf.New(".")
+			if err := k.Load(confmap.Provider(tt.values, ""), nil); err != nil {
+				t.Fatal(err)
+			}
+			got, err := resolveSecrets(k)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("resolveSecrets() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveSecrets() error = %v", err)
+			}
+			if !reflect.DeepEqual(got.Raw(), tt.want) {
+				t.Errorf("resolveSecrets() = %v, want %v", got.Raw(), tt.want)
+			}
+			for _, s := range tt.secrets {
+				if !isSecret(s) {
+					t.Errorf("isSecret(%s) = false, want true", s)
+				}
+			}
+		})
+	}
+
+	// Each reference is resolved only once per run
+	calls = 0
+	k := koanf.New(".")
+	_ = k.Load(confmap.Provider(map[string]any{"a": "secret://test/x", "b": "secret://test/x"}, ""), nil)
+	if _, err := resolveSecrets(k); err != nil {
+		t.Fatalf("resolveSecrets() error = %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("resolveSecrets() called provider %d times, want 1", calls)
+	}
+	if !isSecret("a") || isSecret("c") {
+		t.Errorf("isSecret() did not record the resolved keys")
+	}
+	resetSecrets()
+}
+
+func Test_execSecret(t *testing.T) {
+	if _, err := exec.LookPath("echo"); err != nil {
+		t.Skip("echo is not available")
+	}
+	got, err := execSecret("echo  hello   world")
+	if err != nil {
+		t.Fatalf("execSecret() error = %v", err)
+	}
+	if got != "hello world" {
+		t.Errorf("execSecret() = %q, want %q", got, "hello world")
+	}
+	if _, err = execSecret(""); err == nil {
+		t.Errorf("execSecret() with no command succeeded")
+	}
+}
+
+func Test_keyringSecret(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the fake secret-tool is a shell script")
+	}
+	dir := t.TempDir()
+	script := "#!/bin/sh\n[ \"$*\" = \"lookup service myapp account db\" ] || { echo no such secret >&2; exit 1; }\necho hunter2\n"
+	if err := os.WriteFile(filepath.Join(dir, "secret-tool"), []byte(script), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir)
+	tests := []struct {
+		name    string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{name: "found", value: "secret://keyring/myapp/db", want: "hunter2"},
+		{name: "missing", value: "secret://keyring/myapp/web", wantErr: true},
+		{name: "no account", value: "secret://keyring/myapp", wantErr: true},
+		{name: "no service", value: "secret://keyring//db", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveSecret(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveSecret() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("resolveSecret() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+// Copyright © 2024 Bruce Smith <bruceesmith@gmail.com>
+// Use of this source code is governed by the MIT
+// License that can be found in the LICENSE file.
+
+package echidna
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/knadh/koanf/maps"
+	"github.com/knadh/koanf/parsers/toml"
+	"github.com/knadh/koanf/parsers/yaml"
+	"github.com/knadh/koanf/providers/confmap"
+	"github.com/knadh/koanf/v2"
+	"github.com/urfave/cli/v3"
+)
+
+// ConfigCommand is an Option which adds a "config" command to the program, with
+// subcommands that operate upon the configuration:
+//
+//	config show [--format text|json|yaml|toml] [--origin] [KEY]
+//	config validate [FILE...]
+//	config init [--format yaml|toml|json] [--force] [FILE]
+//	config schema
+//
+// "config show" loads the configuration exactly as for any other command, from
+// defaults, the sources given by --config, the environment and command-line
+// flags, and prints the result with all secrets redacted. If KEY is given then
+// only the value or sub-tree at that key path (for example "server.tls") is printed.
+// With --origin, the [Origin] of each value is shown alongside it.
+//
+// "config validate" checks configuration files without running any Action: the
+// files are loaded into a copy of the configuration struct holding only its defaults,
+// which is then validated. Every problem is reported with its file and key where
+// known (as JSON with --json), and the exit status is [ExitCodeInvalidConfig] if
+// there are any.
+//
+// "config init" writes a sample configuration file holding every key with its
+// default value, commented with the key's description from the tag set by [DescTag].
+// Secrets are left blank, and an existing file is only overwritten with --force.
+//
+// "config schema" prints the [JSONSchema] of the configuration
+func ConfigCommand() Option {
+	return func() error {
+		addConfigCommand(showCommand(), false)
+		addConfigCommand(validateCommand(), true)
+		addConfigCommand(initCommand(), true)
+		addConfigCommand(schemaCommand(), true)
+		return nil
+	}
+}
+
+// showCommand returns the "config show" subcommand
+func showCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "show",
+		Usage:     "print the effective configuration",
+		ArgsUsage: "[KEY]",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "format",
+				Usage: "output format: text, json, yaml or toml",
+				Value: "text",
+			},
+			&cli.BoolFlag{
+				Name:  "origin",
+				Usage: "show where each value came from",
+			},
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			if cmd.Args().Len() > 1 {
+				return fmt.Errorf("config show accepts at most one key")
+			}
+			return showConfig(cmd.Root().Writer, redactedConfig(configuration), cmd.Args().First(), cmd.String("format"), cmd.Bool("origin"))
+		},
+	}
+}
+
+// showConfig writes a configuration, or the part of it at key, in the
+// requested format. If origin is true, then each leaf value is replaced
+// by its value and origin
+func showConfig(w io.Writer, config map[string]any, key, format string, origin bool) error {
+	var value any = config
+	if key != "" {
+		k := koanf.New(".")
+		if err := k.Load(confmap.Provider(config, ""), nil); err != nil {
+			return err
+		}
+		if !k.Exists(key) {
+			return fmt.Errorf("the configuration has no key %s", key)
+		}
+		value = k.Get(key)
+	}
+	structured := value
+	if origin {
+		structured = withOrigins(flatten(key, value))
+	}
+	var (
+		out []byte
+		err error
+	)
+	switch strings.ToLower(format) {
+	case "text":
+		out = textConfig(flatten(key, value), origin)
+	case "json":
+		out, err = json.MarshalIndent(structured, "", "  ")
+		out = append(out, '\n')
+	case "yaml":
+		out, err = yaml.Parser().Marshal(asMap(key, structured))
+	case "toml":
+		out, err = toml.Parser().Marshal(asMap(key, structured))
+	default:
+		return fmt.Errorf("unknown configuration format %q", format)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to format the configuration: [%w]", err)
+	}
+	_, err = w.Write(out)
+	return err
+}
+
+// asMap wraps a value which is not a map in one keyed by the last
+// element of its key path, as some formats require a map
+func asMap(key string, value any) map[string]any {
+	if m, ok := value.(map[string]any); ok {
+		return m
+	}
+	return map[string]any{key[strings.LastIndex(key, ".")+1:]: value}
+}
+
+// flatten returns the leaves of a configuration value, indexed by
+// their full key paths
+func flatten(key string, value any) map[string]any {
+	m, ok := value.(map[string]any)
+	if !ok {
+		return map[string]any{key: value}
+	}
+	flat, _ := maps.Flatten(m, nil, ".")
+	if key == "" {
+		return flat
+	}
+	prefixed := make(map[string]any, len(flat))
+	for k, v := range flat {
+		prefixed[key+"."+k] = v
+	}
+	return prefixed
+}
+
+// withOrigins pairs each of a set of leaf values with its origin
+func withOrigins(flat map[string]any) map[string]any {
+	result := make(map[string]any, len(flat))
+	for k, v := range flat {
+		origin, _ := OriginOf(k)
+		result[k] = map[string]any{"value": v, "origin": origin.String()}
+	}
+	return result
+}
+
+// textConfig formats the leaves of a configuration as one "key = value"
+// line each, followed by the origin of the value if origin is true
+func textConfig(flat map[string]any, origin bool) []byte {
+	keys := make([]string, 0, len(flat))
+	for k := range flat {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		fmt.Fprintf(&b, "%s = %s", k, textValue(flat[k]))
+		if origin {
+			o, _ := OriginOf(k)
+			fmt.Fprintf(&b, "  # %s", o)
+		}
+		b.WriteString("\n")
+	}
+	return []byte(b.String())
+}
+
+// textValue formats a single configuration value for text output
+func textValue(v any) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case nil:
+		return ""
+	case []any, map[string]any:
+		b, err := json.Marshal(t)
+		if err == nil {
+			return string(b)
+		}
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,129 @@
+// Copyright © 2024 Bruce Smith <bruceesmith@gmail.com>
+// Use of this source code is governed by the MIT
+// License that can be found in the LICENSE file.
+
+package echidna
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/urfave/cli/v3"
+)
+
+func Test_showConfig(t *testing.T) {
+	cfg := map[string]any{
+		"host": "localhost",
+		"port": 8080,
+		"tls":  map[string]any{"cert": "/etc/cert.pem", "enabled": true},
+		"tags": []any{"a", "b"},
+	}
+	tests := []struct {
+		name    string
+		key     string
+		format  string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "text",
+			format: "text",
+			want:   "host = localhost\nport = 8080\ntags = [\"a\",\"b\"]\ntls.cert = /etc/cert.pem\ntls.enabled = true\n",
+		},
+		{
+			name:   "text-key",
+			key:    "tls",
+			format: "text",
+			want:   "tls.cert = /etc/cert.pem\ntls.enabled = true\n",
+		},
+		{
+			name:   "text-leaf",
+			key:    "tls.cert",
+			format: "TEXT",
+			want:   "tls.cert = /etc/cert.pem\n",
+		},
+		{
+			name:   "json-key",
+			key:    "tls",
+			format: "json",
+			want:   "{\n  \"cert\": \"/etc/cert.pem\",\n  \"enabled\": true\n}\n",
+		},
+		{
+			name:   "yaml-key",
+			key:    "tls",
+			format: "yaml",
+			want:   "cert: /etc/cert.pem\nenabled: true\n",
+		},
+		{
+			name:   "toml-leaf",
+			key:    "port",
+			format: "toml",
+			want:   "port = 8080\n",
+		},
+		{
+			name:    "missing-key",
+			key:     "nope",
+			format:  "text",
+			wantErr: true,
+		},
+		{
+			name:    "bad-format",
+			format:  "xml",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			err := showConfig(buf, cfg, tt.key, tt.format, false)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("showConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := buf.String(); !tt.wantErr && got != tt.want {
+				t.Errorf("showConfig() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_configShow(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.yml")
+	content := "host: example.com\ntoken: tok-123456\nusers:\n  - name: bob\n    password: bobs-password\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	var cfg redactConfig
+	configuration = &cfg
+	configloaders = DefaultLoaders()
+	if err := ConfigCommand()(); err != nil {
+		t.Fatalf("ConfigCommand() error = %v", err)
+	}
+	defer func() {
+		configuration = nil
+		configloaders = nil
+		configCommands = nil
+		standaloneCommands.Clear()
+	}()
+	buf := &bytes.Buffer{}
+	cmd := &cli.Command{
+		Name:   "test",
+		Before: before,
+		Flags: []cli.Flag{
+			&cli.StringSliceFlag{Name: "config"},
+		},
+		Commands:  []*cli.Command{configCommand()},
+		Writer:    buf,
+		ErrWriter: buf,
+	}
+	err := cmd.Run(context.Background(), []string{"test", "--config", path, "config", "show", "--format", "json", "users"})
+	if err != nil {
+		t.Fatalf("config show error = %v", err)
+	}
+	want := "[\n  {\n    \"name\": \"bob\",\n    \"password\": \"[REDACTED]\"\n  }\n]\n"
+	if buf.String() != want {
+		t.Errorf("config show = %q, want %q", buf.String(), want)
+	}
+}
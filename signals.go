@@ -0,0 +1,173 @@
+// Copyright © 2024 Bruce Smith <bruceesmith@gmail.com>
+// Use of this source code is governed by the MIT
+// License that can be found in the LICENSE file.
+
+package echidna
+
+import (
+	"io"
+	"os"
+	"os/signal"
+	"slices"
+	"sync"
+	"syscall"
+
+	"github.com/bruceesmith/logger"
+	"github.com/urfave/cli/v3"
+)
+
+// Reopener is implemented by a log destination which can be closed and
+// opened again, so that a log file renamed by a log rotation tool is
+// replaced by a new one
+type Reopener interface {
+	Reopen() error
+}
+
+// LogFile is a log file, suitable for the Writer or ErrWriter of a
+// command, which implements [Reopener]
+type LogFile struct {
+	path string
+	mode os.FileMode
+	mu   sync.Mutex
+	file *os.File
+}
+
+// signalHandler reloads the configuration when the process receives SIGHUP
+type signalHandler struct {
+	signals chan os.Signal
+	done    chan struct{}
+}
+
+var (
+	// reloadOnSignal is set by ReloadOnSignal
+	reloadOnSignal bool
+
+	// signalReopeners are the log destinations added by ReopenOnSignal
+	signalReopeners []Reopener
+
+	// hangups is the active handler of SIGHUP, if any
+	hangups *signalHandler
+)
+
+// ReloadOnSignal is an Option which reloads the configuration each time the
+// process receives SIGHUP. The configuration is loaded, overridden by flag
+// values and validated in the same way as when the program started, and the
+// result is logged. If it succeeds, [Current] returns the new configuration
+// and the functions registered by [OnReload] are called; otherwise the
+// previous configuration remains in use.
+//
+// Before the configuration is reloaded, the Writer and ErrWriter of the root
+// command are reopened if they implement [Reopener], as [LogFile] does, so
+// that SIGHUP can also be sent after rotating log files. Other destinations,
+// such as a [LogFile] given to the logger, are added by [ReopenOnSignal]
+func ReloadOnSignal() Option {
+	return func() error {
+		reloadOnSignal = true
+		return nil
+	}
+}
+
+// ReopenOnSignal is an Option which adds log destinations to be reopened
+// along with the Writer and ErrWriter of the root command when SIGHUP is
+// handled by [ReloadOnSignal]. It is needed for a log file which is not one
+// of those writers, for example one passed to logger.Configure as the
+// destination of the normal or trace logger
+func ReopenOnSignal(reopeners ...Reopener) Option {
+	return func() error {
+		signalReopeners = append(signalReopeners, reopeners...)
+		return nil
+	}
+}
+
+// OpenLogFile opens a file for appending log entries, creating it
+// with the given permissions if it does not exist
+func OpenLogFile(path string, mode os.FileMode) (*LogFile, error) {
+	lf := &LogFile{path: path, mode: mode}
+	if err := lf.Reopen(); err != nil {
+		return nil, err
+	}
+	return lf, nil
+}
+
+// Write appends to the log file
+func (lf *LogFile) Write(p []byte) (int, error) {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+	return lf.file.Write(p)
+}
+
+// Reopen closes the log file and opens it again by name
+func (lf *LogFile) Reopen() error {
+	file, err := os.OpenFile(lf.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, lf.mode)
+	if err != nil {
+		return err
+	}
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+	if lf.file != nil {
+		lf.file.Close()
+	}
+	lf.file = file
+	return nil
+}
+
+// Close closes the log file
+func (lf *LogFile) Close() error {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+	return lf.file.Close()
+}
+
+// startSignals begins handling SIGHUP for a command
+func startSignals(cmd *cli.Command) {
+	stopSignals()
+	hangups = &signalHandler{
+		signals: make(chan os.Signal, 1),
+		done:    make(chan struct{}),
+	}
+	signal.Notify(hangups.signals, syscall.SIGHUP)
+	go hangups.run(cmd)
+}
+
+// stopSignals stops handling SIGHUP, if it is being handled,
+// and waits for the handler to finish
+func stopSignals() {
+	if hangups == nil {
+		return
+	}
+	signal.Stop(hangups.signals)
+	close(hangups.signals)
+	<-hangups.done
+	hangups = nil
+}
+
+// run reopens the logs and reloads the configuration on each SIGHUP
+func (sh *signalHandler) run(cmd *cli.Command) {
+	defer close(sh.done)
+	for range sh.signals {
+		logger.Info("Received SIGHUP")
+		reopenLogs(signalReopeners, cmd.Root().Writer, cmd.Root().ErrWriter)
+		reloadAndLog("SIGHUP")
+	}
+}
+
+// reopenLogs reopens each distinct log destination, being the reopeners
+// and those writers which implement Reopener
+func reopenLogs(reopeners []Reopener, writers ...io.Writer) {
+	reopeners = slices.Clone(reopeners)
+	for _, w := range writers {
+		if r, ok := w.(Reopener); ok {
+			reopeners = append(reopeners, r)
+		}
+	}
+	var reopened []Reopener
+	for _, r := range reopeners {
+		if slices.Contains(reopened, r) {
+			continue
+		}
+		reopened = append(reopened, r)
+		if err := r.Reopen(); err != nil {
+			logger.Error("Error reopening a log file", "error", err.Error())
+		}
+	}
+}
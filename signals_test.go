@@ -0,0 +1,177 @@
+// Copyright © 2024 Bruce Smith <bruceesmith@gmail.com>
+// Use of this source code is governed by the MIT
+// License that can be found in the LICENSE file.
+
+//go:build unix
+
+package echidna
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/bruceesmith/logger"
+)
+
+func Test_ReloadOnSignal(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.yml")
+	if err := os.WriteFile(path, []byte("name: first\nport: 80\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	logPath := filepath.Join(dir, "app.log")
+	logFile, err := OpenLogFile(logPath, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logFile.Close()
+	var cfg reloadConfig
+	cmd := reloadCommand(t, &cfg)
+	cmd.Writer = logFile
+	events := make(chan ReloadEvent, 10)
+	defer func() {
+		stopSignals()
+		configuration = nil
+		pristine = nil
+		configloaders = nil
+		reloadListeners = nil
+		reloadState = nil
+		reloadOnSignal = false
+		runArgs = nil
+		publish(nil)
+		resetOrigins()
+	}()
+	if err = ReloadOnSignal()(); err != nil {
+		t.Fatal(err)
+	}
+	if err = OnReload(func(e ReloadEvent) { events <- e })(); err != nil {
+		t.Fatal(err)
+	}
+	runArgs = []string{"test", "--config", path}
+	if err = cmd.Run(context.Background(), runArgs); err != nil {
+		t.Fatalf("before() error = %v", err)
+	}
+
+	// Rotate the log, change the configuration and send SIGHUP
+	if err = os.Rename(logPath, logPath+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(path, []byte("name: second\nport: 81\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err = syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case e := <-events:
+		if updated, _ := e.New.(*reloadConfig); updated == nil || *updated != (reloadConfig{Name: "second", Port: 81}) {
+			t.Errorf("ReloadEvent.New = %+v", e.New)
+		}
+		if e.Trigger != "SIGHUP" {
+			t.Errorf("ReloadEvent.Trigger = %v, want SIGHUP", e.Trigger)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the configuration was not reloaded")
+	}
+	if _, err = os.Stat(logPath); err != nil {
+		t.Errorf("the log file was not reopened: %v", err)
+	}
+}
+
+func Test_ReopenOnSignal(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.yml")
+	if err := os.WriteFile(path, []byte("name: first\nport: 80\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	logPath := filepath.Join(dir, "app.log")
+	logFile, err := OpenLogFile(logPath, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logFile.Close()
+	// The logger writes to the file, which is not a writer of the command
+	err = logger.Configure(logger.ConfigSetting{AppliesTo: logger.Norm, Key: logger.DestinationSetting, Value: logFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cfg reloadConfig
+	cmd := reloadCommand(t, &cfg)
+	events := make(chan ReloadEvent, 10)
+	defer func() {
+		stopSignals()
+		logger.RedirectStandard(os.Stdout)
+		configuration = nil
+		pristine = nil
+		configloaders = nil
+		reloadListeners = nil
+		reloadState = nil
+		reloadOnSignal = false
+		signalReopeners = nil
+		runArgs = nil
+		publish(nil)
+		resetOrigins()
+	}()
+	for _, option := range []Option{ReloadOnSignal(), ReopenOnSignal(logFile), OnReload(func(e ReloadEvent) { events <- e })} {
+		if err = option(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	runArgs = []string{"test", "--config", path}
+	if err = cmd.Run(context.Background(), runArgs); err != nil {
+		t.Fatalf("before() error = %v", err)
+	}
+
+	// Rotate the log, change the configuration and send SIGHUP
+	if err = os.Rename(logPath, logPath+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(path, []byte("name: second\nport: 81\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err = syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-events:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the configuration was not reloaded")
+	}
+	logger.Info("after rotation")
+	rotated, _ := os.ReadFile(logPath + ".1")
+	if !strings.Contains(string(rotated), "Received SIGHUP") || strings.Contains(string(rotated), "after rotation") {
+		t.Errorf("the rotated log file holds %q", rotated)
+	}
+	if current, _ := os.ReadFile(logPath); !strings.Contains(string(current), "after rotation") {
+		t.Errorf("the log file was not reopened, it holds %q", current)
+	}
+}
+
+func TestLogFile_Reopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	lf, err := OpenLogFile(path, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lf.Close()
+	if _, err = lf.Write([]byte("one\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	reopenLogs([]Reopener{lf}, lf, lf)
+	if _, err = lf.Write([]byte("two\n")); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{path + ".1": "one\n", path: "two\n"} {
+		if b, _ := os.ReadFile(name); string(b) != want {
+			t.Errorf("%s holds %q, want %q", filepath.Base(name), b, want)
+		}
+	}
+}
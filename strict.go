@@ -0,0 +1,182 @@
+// Copyright © 2024 Bruce Smith <bruceesmith@gmail.com>
+// Use of this source code is governed by the MIT
+// License that can be found in the LICENSE file.
+
+package echidna
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/bruceesmith/logger"
+	"github.com/knadh/koanf/v2"
+)
+
+// strictMode determines how configuration keys without a field are treated
+type strictMode int
+
+const (
+	strictOff    strictMode = iota // Unknown keys are ignored
+	strictReject                   // Unknown keys are an error
+	strictWarn                     // Unknown keys are logged as warnings
+)
+
+// UnknownKeyError reports a configuration key which does not
+// correspond to any field of the configuration struct
+type UnknownKeyError struct {
+	Key        string // The unknown key, such as databse or server.prot
+	Origin     Origin // Where the key was set
+	Suggestion string // The nearest valid key, if one is similar enough
+}
+
+var (
+	// strict is set by StrictConfig
+	strict strictMode
+)
+
+// StrictConfig is an Option which checks every key loaded into the
+// configuration against the fields of the configuration struct. Keys
+// with no matching field, often the result of a misspelling, are
+// reported along with the file (or environment variable) which set them
+// and the nearest valid key. Keys within map fields, and the top-level
+// extends and include keys, are always accepted.
+//
+// Unknown keys cause loading of the configuration to fail, unless
+// warnOnly is true, in which case each one is logged as a warning
+func StrictConfig(warnOnly bool) Option {
+	return func() error {
+		strict = strictReject
+		if warnOnly {
+			strict = strictWarn
+		}
+		return nil
+	}
+}
+
+// Error describes the unknown key, its origin and the suggested alternative
+func (e *UnknownKeyError) Error() string {
+	msg := e.Key + ": unknown configuration key"
+	if e.Origin.Source != "" {
+		msg += " in " + e.Origin.String()
+	}
+	if e.Suggestion != "" {
+		msg += fmt.Sprintf(" (did you mean %s?)", e.Suggestion)
+	}
+	return msg
+}
+
+// checkUnknownKeys applies StrictConfig to the keys loaded into a
+// configuration struct
+func checkUnknownKeys(k *koanf.Koanf, config any) error {
+	raw := k.Raw()
+	delete(raw, extendsKey)
+	delete(raw, includeKey)
+	var unknown []*UnknownKeyError
+	findUnknownKeys(raw, reflect.TypeOf(config), "", &unknown)
+	if strict == strictWarn {
+		for _, u := range unknown {
+			logger.Warn("Unknown configuration key", "key", u.Key, "origin", u.Origin.String(), "suggestion", u.Suggestion)
+		}
+		return nil
+	}
+	errs := make([]error, len(unknown))
+	for i, u := range unknown {
+		errs[i] = u
+	}
+	return errors.Join(errs...)
+}
+
+// findUnknownKeys is a recursive function which compares the keys of a
+// configuration map with the fields of a struct type, adding those which
+// have no field to unknown
+func findUnknownKeys(m map[string]any, t reflect.Type, prefix string, unknown *[]*UnknownKeyError) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if !isNested(t) {
+		return
+	}
+	var names []string
+	fields := make(map[string]reflect.Type)
+	for i := range t.NumField() {
+		if name := strings.ToLower(keyName(t.Field(i))); name != "" {
+			names = append(names, name)
+			fields[name] = t.Field(i).Type
+		}
+	}
+	for _, key := range slices.Sorted(maps.Keys(m)) {
+		path := joinKey(prefix, key)
+		ft, ok := fields[strings.ToLower(key)]
+		if !ok {
+			u := &UnknownKeyError{Key: path}
+			u.Origin, _ = OriginOf(path)
+			if nearest := nearestName(strings.ToLower(key), names); nearest != "" {
+				u.Suggestion = joinKey(prefix, nearest)
+			}
+			*unknown = append(*unknown, u)
+			continue
+		}
+		for ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		switch value := m[key].(type) {
+		case map[string]any:
+			if ft.Kind() == reflect.Map {
+				for _, mk := range slices.Sorted(maps.Keys(value)) {
+					if mm, ok := value[mk].(map[string]any); ok {
+						findUnknownKeys(mm, ft.Elem(), joinKey(path, mk), unknown)
+					}
+				}
+				continue
+			}
+			findUnknownKeys(value, ft, path, unknown)
+		case []any:
+			if ft.Kind() != reflect.Slice && ft.Kind() != reflect.Array {
+				continue
+			}
+			for i, element := range value {
+				if em, ok := element.(map[string]any); ok {
+					findUnknownKeys(em, ft.Elem(), fmt.Sprintf("%s[%d]", path, i), unknown)
+				}
+			}
+		}
+	}
+}
+
+// nearestName returns the name closest to name in edit distance, provided
+// that it is close enough to be a plausible misspelling
+func nearestName(name string, names []string) string {
+	best, bestDistance := "", max(2, len(name)/3)+1
+	for _, n := range names {
+		if d := editDistance(name, n); d < bestDistance {
+			best, bestDistance = n, d
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between two strings
+func editDistance(a, b string) int {
+	ar, br := []rune(a), []rune(b)
+	previous := make([]int, len(br)+1)
+	current := make([]int, len(br)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := range ar {
+		current[0] = i + 1
+		for j := range br {
+			cost := 1
+			if ar[i] == br[j] {
+				cost = 0
+			}
+			current[j+1] = min(previous[j+1]+1, current[j]+1, previous[j]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(br)]
+}
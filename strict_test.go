@@ -0,0 +1,118 @@
+// Copyright © 2024 Bruce Smith <bruceesmith@gmail.com>
+// Use of this source code is governed by the MIT
+// License that can be found in the LICENSE file.
+
+package echidna
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+type strictDatabase struct {
+	Host string `koanf:"host"`
+	Port int    `koanf:"port"`
+}
+
+type strictConfig struct {
+	Name     string                    `koanf:"name"`
+	Database strictDatabase            `koanf:"database"`
+	Replicas []strictDatabase          `koanf:"replicas"`
+	Shards   map[string]strictDatabase `koanf:"shards"`
+	Labels   map[string]string         `koanf:"labels"`
+	Any      any                       `koanf:"any"`
+}
+
+func (s *strictConfig) Validate() error { return nil }
+
+func Test_editDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{a: "", b: "", want: 0},
+		{a: "abc", b: "", want: 3},
+		{a: "database", b: "databse", want: 1},
+		{a: "port", b: "prot", want: 2},
+		{a: "kitten", b: "sitting", want: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.a+"-"+tt.b, func(t *testing.T) {
+			if got := editDistance(tt.a, tt.b); got != tt.want {
+				t.Errorf("editDistance() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_checkUnknownKeys(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good.yml")
+	bad := filepath.Join(dir, "bad.yml")
+	files := map[string]string{
+		good: "name: app\ndatabase:\n  host: db\nlabels:\n  anything: goes\nany:\n  deep: value\n",
+		bad: "nmae: app\ndatabse:\n  host: db\nreplicas:\n  - host: r1\n    prot: 1\n" +
+			"shards:\n  a:\n    hots: s1\nunrelated: x\ninclude: []\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(name, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	configloaders = DefaultLoaders()
+	defer func() {
+		configloaders = nil
+		strict = strictOff
+		resetOrigins()
+	}()
+
+	strict = strictReject
+	ls, err := loaders([]string{good})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = configure(&strictConfig{}, ls); err != nil {
+		t.Errorf("configure() of known keys error = %v", err)
+	}
+
+	ls, err = loaders([]string{bad})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = configure(&strictConfig{}, ls)
+	var got []UnknownKeyError
+	for _, e := range splitErrors(err) {
+		var uk *UnknownKeyError
+		if !errors.As(e, &uk) {
+			t.Fatalf("configure() error = %v, want UnknownKeyErrors", e)
+		}
+		got = append(got, *uk)
+	}
+	origin := func(line int) Origin { return Origin{Kind: OriginFile, Source: bad, Line: line} }
+	want := []UnknownKeyError{
+		{Key: "databse", Origin: origin(3), Suggestion: "database"},
+		{Key: "nmae", Origin: origin(1), Suggestion: "name"},
+		{Key: "replicas[0].prot", Origin: origin(4), Suggestion: "replicas[0].port"},
+		{Key: "shards.a.hots", Origin: origin(9), Suggestion: "shards.a.host"},
+		{Key: "unrelated", Origin: origin(10)},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("configure() unknown keys =\n%v\nwant\n%v", got, want)
+	}
+	wantMsg := "databse: unknown configuration key in file " + bad + ":3 (did you mean database?)"
+	if msg := want[0].Error(); msg != wantMsg {
+		t.Errorf("UnknownKeyError.Error() = %v, want %v", msg, wantMsg)
+	}
+
+	strict = strictWarn
+	var cfg strictConfig
+	if err = configure(&cfg, ls); err != nil {
+		t.Errorf("configure() in warn-only mode error = %v", err)
+	}
+	if cfg.Replicas[0].Host != "r1" {
+		t.Errorf("configure() in warn-only mode did not load the configuration")
+	}
+}
@@ -0,0 +1 @@
+i = 33
@@ -0,0 +1,228 @@
+// Copyright © 2024 Bruce Smith <bruceesmith@gmail.com>
+// Use of this source code is governed by the MIT
+// License that can be found in the LICENSE file.
+
+package echidna
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/go-viper/mapstructure/v2"
+	"github.com/urfave/cli/v3"
+)
+
+const (
+	// ExitCodeInvalidConfig is the exit status of "config validate"
+	// when the configuration is not valid
+	ExitCodeInvalidConfig = 3
+)
+
+var (
+	// pristine is a copy of the configuration struct holding only its
+	// defaults, taken before any configuration source was loaded
+	pristine Configurator
+)
+
+// validationProblem is a single problem found by "config validate"
+type validationProblem struct {
+	File    string `json:"file,omitempty"`
+	Line    int    `json:"line,omitempty"`
+	Key     string `json:"key,omitempty"`
+	Message string `json:"message"`
+}
+
+// String formats a problem as file:line: key: message
+func (p validationProblem) String() string {
+	var parts []string
+	switch {
+	case p.File != "" && p.Line > 0:
+		parts = append(parts, fmt.Sprintf("%s:%d", p.File, p.Line))
+	case p.File != "":
+		parts = append(parts, p.File)
+	}
+	if p.Key != "" {
+		parts = append(parts, p.Key)
+	}
+	return strings.Join(append(parts, p.Message), ": ")
+}
+
+// validationReport is the result of "config validate"
+type validationReport struct {
+	Valid    bool                `json:"valid"`
+	Problems []validationProblem `json:"problems"`
+}
+
+// validateCommand returns the "config validate" subcommand
+func validateCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "validate",
+		Usage: "check configuration files without running the program",
+		Description: "Each file is loaded, parsed, stored in a configuration struct holding only its\n" +
+			"defaults, and validated. Every problem found is reported, and the exit status is\n" +
+			fmt.Sprintf("%d if there are any. With --json, the report is written as JSON. If no files are\n", ExitCodeInvalidConfig) +
+			"given, those named by --config (or found by discovery) are validated",
+		ArgsUsage: "[FILE...]",
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			files := cmd.Args().Slice()
+			if len(files) == 0 {
+				files = cmd.StringSlice("config")
+			}
+			if len(files) == 0 && discoveryName != "" {
+				files = discover(discoveryName)
+			}
+			report := validationReport{Problems: validateFiles(files)}
+			report.Valid = len(report.Problems) == 0
+			if err := writeReport(cmd.Root().Writer, report, cmd.Bool("json")); err != nil {
+				return err
+			}
+			if !report.Valid {
+				return cli.Exit("", ExitCodeInvalidConfig)
+			}
+			return nil
+		},
+	}
+}
+
+// validateFiles loads a set of configuration sources into a copy of the
+// configuration struct holding only its defaults, validates the result,
+// and returns every problem found
+func validateFiles(paths []string) []validationProblem {
+	ls, err := loaders(paths)
+	if err != nil {
+		return []validationProblem{{Message: err.Error()}}
+	}
+	// Check that each file can be read and parsed by itself, so that
+	// problems are attributed to the right file. Standard input can only
+	// be read once, so it is left to be read with the others
+	var problems []validationProblem
+	for _, l := range ls {
+		if l.Path == "-" {
+			continue
+		}
+		if _, _, err = readSource(l); err != nil {
+			problems = append(problems, validationProblem{File: l.Path, Message: err.Error()})
+		}
+	}
+	if len(problems) > 0 {
+		return problems
+	}
+	cfg := clone(pristine)
+	if err = configure(cfg, ls); err != nil {
+		return decodeProblems(err)
+	}
+	return validationProblems(validateConfig(cfg))
+}
+
+// validationProblems converts an error from validateConfig into problems,
+// attributing each value that failed a validate tag rule to the file that
+// set it. Messages are redacted
+func validationProblems(err error) []validationProblem {
+	var problems []validationProblem
+	for _, e := range splitErrors(err) {
+		var fe *FieldError
+		if !errors.As(e, &fe) {
+			problems = append(problems, validationProblem{Message: redactError(e).Error()})
+			continue
+		}
+		problem := validationProblem{Key: fe.Key, Message: redactText(fe.Message)}
+		if origin, ok := OriginOf(fe.Key); ok && fe.Key != "" && origin.Kind == OriginFile {
+			problem.File = origin.Source
+			problem.Line = origin.Line
+		}
+		problems = append(problems, problem)
+	}
+	return problems
+}
+
+// decodeProblems converts an error from configure into problems, attributing
+// each value that could not be stored in the struct, and each unknown key,
+// to the file that set it
+func decodeProblems(err error) []validationProblem {
+	var problems []validationProblem
+	for _, e := range splitErrors(err) {
+		var uk *UnknownKeyError
+		if errors.As(e, &uk) {
+			problem := validationProblem{Key: uk.Key, Message: "unknown configuration key"}
+			if uk.Suggestion != "" {
+				problem.Message += fmt.Sprintf(" (did you mean %s?)", uk.Suggestion)
+			}
+			if uk.Origin.Kind == OriginFile {
+				problem.File = uk.Origin.Source
+				problem.Line = uk.Origin.Line
+			}
+			problems = append(problems, problem)
+			continue
+		}
+		var de *mapstructure.DecodeError
+		if !errors.As(e, &de) {
+			problems = append(problems, validationProblem{Message: e.Error()})
+			continue
+		}
+		problem := validationProblem{Key: de.Name(), Message: de.Unwrap().Error()}
+		if origin, ok := OriginOf(de.Name()); ok && origin.Kind == OriginFile {
+			problem.File = origin.Source
+			problem.Line = origin.Line
+		}
+		problems = append(problems, problem)
+	}
+	return problems
+}
+
+// splitErrors returns the individual errors within an error, descending
+// through errors that wrap, or that join, other errors
+func splitErrors(err error) []error {
+	if err == nil {
+		return nil
+	}
+	switch e := err.(type) {
+	case interface{ Unwrap() []error }:
+		var result []error
+		for _, inner := range e.Unwrap() {
+			result = append(result, splitErrors(inner)...)
+		}
+		return result
+	case *mapstructure.DecodeError:
+		return []error{err}
+	case interface{ Unwrap() error }:
+		if inner := splitErrors(e.Unwrap()); len(inner) > 1 || (len(inner) == 1 && isDecodeError(inner[0])) {
+			return inner
+		}
+	}
+	return []error{err}
+}
+
+// isDecodeError reports whether an error is a mapstructure.DecodeError
+func isDecodeError(err error) bool {
+	_, ok := err.(*mapstructure.DecodeError)
+	return ok
+}
+
+// writeReport writes a validation report as text or as JSON
+func writeReport(w io.Writer, report validationReport, asJSON bool) error {
+	if asJSON {
+		if report.Problems == nil {
+			report.Problems = []validationProblem{}
+		}
+		b, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(b))
+		return err
+	}
+	if report.Valid {
+		_, err := fmt.Fprintln(w, "configuration is valid")
+		return err
+	}
+	for _, p := range report.Problems {
+		if _, err := fmt.Fprintln(w, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
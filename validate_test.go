@@ -0,0 +1,212 @@
+// Copyright © 2024 Bruce Smith <bruceesmith@gmail.com>
+// Use of this source code is governed by the MIT
+// License that can be found in the LICENSE file.
+
+package echidna
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli/v3"
+)
+
+func Test_validateFiles(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"good.yml":    "i: 33\n",
+		"invalid.yml": "i: 1\n",
+		"type.yml":    "# the value of i\n\ni: abc\n",
+		"broken.json": `{"i": `,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := func(name string) string { return filepath.Join(dir, name) }
+	tests := []struct {
+		name  string
+		files []string
+		want  []validationProblem
+	}{
+		{
+			name:  "valid",
+			files: []string{path("good.yml")},
+			want:  nil,
+		},
+		{
+			name:  "layered",
+			files: []string{path("invalid.yml"), path("good.yml")},
+			want:  nil,
+		},
+		{
+			name:  "invalid",
+			files: []string{path("invalid.yml")},
+			want:  []validationProblem{{Message: "I must be 33"}},
+		},
+		{
+			name:  "wrong-type",
+			files: []string{path("good.yml"), path("type.yml")},
+			want: []validationProblem{{
+				File:    path("type.yml"),
+				Line:    3,
+				Key:     "i",
+				Message: "cannot parse value as 'int': strconv.ParseInt: invalid syntax",
+			}},
+		},
+		{
+			name:  "unparseable",
+			files: []string{path("broken.json"), path("good.yml")},
+			want:  []validationProblem{{File: path("broken.json"), Message: "unexpected end of JSON input"}},
+		},
+		{
+			name:  "missing",
+			files: []string{path("app.ini")},
+			want:  []validationProblem{{File: path("app.ini"), Message: "open " + path("app.ini") + ": no such file or directory"}},
+		},
+	}
+	configloaders = DefaultLoaders()
+	pristine = &config{}
+	defer func() {
+		configloaders = nil
+		pristine = nil
+		resetOrigins()
+	}()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := validateFiles(tt.files); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("validateFiles() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_validationProblem_String(t *testing.T) {
+	tests := []struct {
+		name    string
+		problem validationProblem
+		want    string
+	}{
+		{
+			name:    "message",
+			problem: validationProblem{Message: "bad"},
+			want:    "bad",
+		},
+		{
+			name:    "file",
+			problem: validationProblem{File: "a.json", Message: "bad"},
+			want:    "a.json: bad",
+		},
+		{
+			name:    "all",
+			problem: validationProblem{File: "a.yml", Line: 2, Key: "i", Message: "bad"},
+			want:    "a.yml:2: i: bad",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.problem.String(); got != tt.want {
+				t.Errorf("validationProblem.String() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_configValidate(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good.yml")
+	bad := filepath.Join(dir, "bad.yml")
+	for path, content := range map[string]string{good: "i: 33\n", bad: "i: 1\n"} {
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var cfg config
+	if err := Configuration(&cfg, DefaultLoaders())(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ConfigCommand()(); err != nil {
+		t.Fatal(err)
+	}
+	exitCode := 0
+	cli.OsExiter = func(code int) { exitCode = code }
+	defer func() {
+		cli.OsExiter = os.Exit
+		configuration = nil
+		configloaders = nil
+		pristine = nil
+		configCommands = nil
+		standaloneCommands.Clear()
+		resetOrigins()
+	}()
+	actioned := false
+	run := func(args ...string) string {
+		buf := &bytes.Buffer{}
+		cmd := &cli.Command{
+			Name:   "test",
+			Before: before,
+			Action: func(context.Context, *cli.Command) error {
+				actioned = true
+				return nil
+			},
+			Flags: []cli.Flag{
+				&cli.StringSliceFlag{Name: "config"},
+				&cli.BoolFlag{Name: "json"},
+			},
+			Commands:  []*cli.Command{configCommand()},
+			Writer:    buf,
+			ErrWriter: buf,
+		}
+		exitCode = 0
+		_ = cmd.Run(context.Background(), append([]string{"test"}, args...))
+		return buf.String()
+	}
+
+	if got := run("config", "validate", good); got != "configuration is valid\n" || exitCode != 0 {
+		t.Errorf("config validate of a valid file = %q, exit code %d", got, exitCode)
+	}
+	// The --config sources are validated when no files are given, and
+	// they need not be valid for the command to run
+	if got := run("--config", bad, "config", "validate"); got != "I must be 33\n" || exitCode != ExitCodeInvalidConfig {
+		t.Errorf("config validate of an invalid file = %q, exit code %d", got, exitCode)
+	}
+	var report validationReport
+	got := run("--json", "config", "validate", bad)
+	if err := json.Unmarshal([]byte(got), &report); err != nil {
+		t.Fatalf("config validate --json wrote %q: %v", got, err)
+	}
+	if report.Valid || len(report.Problems) != 1 || !strings.Contains(report.Problems[0].Message, "33") {
+		t.Errorf("config validate --json = %+v", report)
+	}
+	if cfg.I != 0 || actioned {
+		t.Errorf("config validate changed the configuration or ran the Action")
+	}
+}
+
+func Test_validationProblems(t *testing.T) {
+	recordOrigin("server.port", Origin{Kind: OriginFile, Source: "app.yml", Line: 4})
+	defer resetOrigins()
+	err := fmt.Errorf("configuration validation failed: [%w]", ValidationErrors{
+		{Key: "server.port", Rule: "max=65535", Message: "must be at most 65535"},
+		{Key: "mode", Rule: "oneof=dev prod", Message: "must be one of dev, prod"},
+	})
+	want := []validationProblem{
+		{File: "app.yml", Line: 4, Key: "server.port", Message: "must be at most 65535"},
+		{Key: "mode", Message: "must be one of dev, prod"},
+	}
+	if got := validationProblems(err); !reflect.DeepEqual(got, want) {
+		t.Errorf("validationProblems() = %v, want %v", got, want)
+	}
+	if got := validationProblems(errors.New("I must be 33")); !reflect.DeepEqual(got, []validationProblem{{Message: "I must be 33"}}) {
+		t.Errorf("validationProblems() = %v, want the message alone", got)
+	}
+}